@@ -0,0 +1,249 @@
+package arcbytes
+
+import (
+	"sync"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// Lists of the cache, T1 and T2 hold entries, B1 and B2 only remember the keys evicted from them
+const (
+	listT1 = iota // Seen once recently
+	listT2        // Seen at least twice recently
+	listB1        // Ghosts evicted from T1
+	listB2        // Ghosts evicted from T2
+	listCount
+)
+
+// Cache is a memory bounded cache using the Adaptive Replacement Cache (ARC) policy.
+//
+// Entries seen once sit in T1 and move to T2 on their next hit, both are LRU lists. Evicted
+// entries leave their key behind in the ghost lists B1 and B2. A miss on a B1 ghost means T1
+// was too small and grows its target size p, a miss on a B2 ghost shrinks it, so the cache
+// keeps adapting between recency and frequency heavy workloads.
+//
+// Every size, p included, is counted in bytes: a ghost counts for the memory its entry held,
+// while only keeping the key. T1 and T2 together hold at most maxMemory, T1 and B1 at most
+// maxMemory, and all four lists at most twice maxMemory.
+type Cache struct {
+	maxMemory      int64
+	currentMemory  int64 // Bytes held by T1 and T2
+	target         int64 // Adaptive target p for the bytes held by T1
+	evictBatchSize int
+	entries        []entry
+	freeEntries    []int // Stack of indices of free entries
+	indexMap       map[string]int
+	lists          [listCount]list
+	mu             sync.RWMutex
+}
+
+type entry struct {
+	key, value []byte // value is nil for ghosts
+	size       int64  // Memory held by the entry, kept by its ghost
+	list       uint8
+	prev, next int // prev is towards the most recently used end
+}
+
+type list struct {
+	head, tail int // Most and least recently used
+	memory     int64
+}
+
+func NewARCCache(maxMemory int64, evictBatchSize int) *Cache {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	c := &Cache{
+		maxMemory:      maxMemory,
+		evictBatchSize: evictBatchSize,
+		entries:        make([]entry, 0),
+		freeEntries:    make([]int, 0),
+		indexMap:       make(map[string]int),
+	}
+	for i := range c.lists {
+		c.lists[i] = list{head: -1, tail: -1}
+	}
+	return c
+}
+
+func (c *Cache) estimateMemory(key, value []byte) int64 {
+	return int64(len(key) + len(value) + 10) // Adding constant overhead for index
+}
+
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	keyStr := cx.B2s(key)
+
+	// A hit on the head of T2 changes nothing, so it only needs the read lock
+	c.mu.RLock()
+	idx, ok := c.indexMap[keyStr]
+	if !ok || c.entries[idx].list >= listB1 {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	if idx == c.lists[listT2].head {
+		value := c.entries[idx].value
+		c.mu.RUnlock()
+		return value, true
+	}
+	c.mu.RUnlock()
+
+	// Upgrade to the write lock, the entry may have changed in between
+	c.mu.Lock()
+	idx, ok = c.indexMap[keyStr]
+	if !ok || c.entries[idx].list >= listB1 {
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.detach(idx)
+	c.linkFront(idx, listT2)
+	value := c.entries[idx].value
+	c.mu.Unlock()
+	return value, true
+}
+
+func (c *Cache) Set(key, value []byte) error {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx, ok := c.indexMap[keyStr]
+	if ok && c.entries[idx].list < listB1 {
+		// An update counts as a hit
+		c.remove(idx)
+		if memSize > c.maxMemory {
+			return nil
+		}
+		c.makeRoom(memSize, false)
+		c.insert(key, value, memSize, listT2)
+		return nil
+	}
+
+	if memSize > c.maxMemory {
+		return nil
+	}
+
+	if !ok {
+		c.makeRoom(memSize, false)
+		c.insert(key, value, memSize, listT1)
+		return nil
+	}
+
+	// A ghost hit adapts the target towards the list that would have kept the entry
+	inB2 := c.entries[idx].list == listB2
+	b1, b2 := c.lists[listB1].memory, c.lists[listB2].memory
+	if inB2 {
+		c.target = max(c.target-memSize*max(1, b1/b2), 0)
+	} else {
+		c.target = min(c.target+memSize*max(1, b2/b1), c.maxMemory)
+	}
+	c.remove(idx)
+	c.makeRoom(memSize, inB2)
+	c.insert(key, value, memSize, listT2)
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	c.mu.Lock()
+	if idx, ok := c.indexMap[cx.B2s(key)]; ok {
+		c.remove(idx)
+	}
+	c.mu.Unlock()
+}
+
+// makeRoom evicts from T1 and T2 until memSize more bytes fit, in batches of evictBatchSize
+func (c *Cache) makeRoom(memSize int64, ghostInB2 bool) {
+	for c.currentMemory+memSize > c.maxMemory {
+		for i := 0; i < c.evictBatchSize && c.currentMemory > 0; i++ {
+			c.replace(ghostInB2)
+		}
+	}
+}
+
+// replace moves the least recently used entry of T1 or T2 into its ghost list, T1 gives way
+// while it holds more than the target
+func (c *Cache) replace(ghostInB2 bool) {
+	t1 := c.lists[listT1]
+	from, to := listT2, listB2
+	if t1.tail != -1 && (t1.memory > c.target || (ghostInB2 && t1.memory == c.target) || c.lists[listT2].tail == -1) {
+		from, to = listT1, listB1
+	}
+
+	idx := c.lists[from].tail
+	c.detach(idx)
+	c.currentMemory -= c.entries[idx].size
+	c.entries[idx].value = nil
+	c.linkFront(idx, uint8(to))
+}
+
+// insert links a new entry at the head of T1 or T2 and trims the ghost lists back into their bounds
+func (c *Cache) insert(key, value []byte, memSize int64, to uint8) {
+	var idx int
+	if len(c.freeEntries) > 0 {
+		idx = c.freeEntries[len(c.freeEntries)-1]
+		c.freeEntries = c.freeEntries[:len(c.freeEntries)-1]
+	} else {
+		c.entries = append(c.entries, entry{})
+		idx = len(c.entries) - 1
+	}
+	c.entries[idx] = entry{key: key, value: value, size: memSize, prev: -1, next: -1}
+	c.indexMap[cx.B2s(key)] = idx
+	c.linkFront(idx, to)
+	c.currentMemory += memSize
+
+	l := &c.lists
+	for l[listB1].tail != -1 && l[listT1].memory+l[listB1].memory > c.maxMemory {
+		c.remove(l[listB1].tail)
+	}
+	for l[listB2].tail != -1 && l[listT1].memory+l[listT2].memory+l[listB1].memory+l[listB2].memory > 2*c.maxMemory {
+		c.remove(l[listB2].tail)
+	}
+}
+
+// linkFront inserts an unlinked entry at the head of a list
+func (c *Cache) linkFront(idx int, to uint8) {
+	l := &c.lists[to]
+	e := &c.entries[idx]
+	e.list = to
+	e.prev = -1
+	e.next = l.head
+	if l.head != -1 {
+		c.entries[l.head].prev = idx
+	}
+	l.head = idx
+	if l.tail == -1 {
+		l.tail = idx
+	}
+	l.memory += e.size
+}
+
+func (c *Cache) detach(idx int) {
+	e := &c.entries[idx]
+	l := &c.lists[e.list]
+	if e.prev != -1 {
+		c.entries[e.prev].next = e.next
+	} else {
+		l.head = e.next
+	}
+	if e.next != -1 {
+		c.entries[e.next].prev = e.prev
+	} else {
+		l.tail = e.prev
+	}
+	l.memory -= e.size
+	e.prev = -1
+	e.next = -1
+}
+
+// remove unlinks an entry or ghost and frees its slot, caller must hold the write lock
+func (c *Cache) remove(idx int) {
+	c.detach(idx)
+	e := &c.entries[idx]
+	if e.list < listB1 {
+		c.currentMemory -= e.size
+	}
+	delete(c.indexMap, cx.B2s(e.key))
+	c.entries[idx] = entry{prev: -1, next: -1} // Drop the references so the GC can reclaim them
+	c.freeEntries = append(c.freeEntries, idx)
+}
@@ -0,0 +1,210 @@
+package arcbytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// checkInvariants verifies the lists, index, free slots and the ARC size bounds
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	linked := 0
+	var memory [listCount]int64
+	for l := range c.lists {
+		prev := -1
+		for idx := c.lists[l].head; idx != -1; idx = c.entries[idx].next {
+			e := c.entries[idx]
+			if e.list != uint8(l) || e.prev != prev {
+				t.Fatalf("Entry %d has list %d prev %d, expected %d and %d", idx, e.list, e.prev, l, prev)
+			}
+			if c.indexMap[string(e.key)] != idx {
+				t.Fatalf("Index of %q does not point at entry %d", e.key, idx)
+			}
+			if l >= listB1 && e.value != nil {
+				t.Fatalf("Ghost %q in list %d still holds its value", e.key, l)
+			}
+			memory[l] += e.size
+			prev = idx
+			linked++
+		}
+		if c.lists[l].tail != prev || c.lists[l].memory != memory[l] {
+			t.Fatalf("List %d tail %d memory %d, expected %d and %d", l, c.lists[l].tail, c.lists[l].memory, prev, memory[l])
+		}
+	}
+	if linked != len(c.indexMap) || linked+len(c.freeEntries) != len(c.entries) {
+		t.Fatalf("%d linked, %d indexed, %d free of %d slots", linked, len(c.indexMap), len(c.freeEntries), len(c.entries))
+	}
+	if resident := memory[listT1] + memory[listT2]; resident != c.currentMemory || resident > c.maxMemory {
+		t.Fatalf("T1 and T2 hold %d bytes, currentMemory %d, maxMemory %d", resident, c.currentMemory, c.maxMemory)
+	}
+	if memory[listT1]+memory[listB1] > c.maxMemory {
+		t.Fatalf("T1 and B1 hold %d bytes, more than maxMemory %d", memory[listT1]+memory[listB1], c.maxMemory)
+	}
+	if memory[listT1]+memory[listT2]+memory[listB1]+memory[listB2] > 2*c.maxMemory {
+		t.Fatalf("All lists hold more than twice maxMemory %d", c.maxMemory)
+	}
+	if c.target < 0 || c.target > c.maxMemory {
+		t.Fatalf("Target %d outside [0, %d]", c.target, c.maxMemory)
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	cache := NewARCCache(1024, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	if cache.entries[cache.indexMap["a"]].list != listT2 {
+		t.Errorf("Expected a hit to move a into T2")
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("a"))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	cache.Set([]byte("huge"), make([]byte, 2048))
+	if _, ok := cache.Get([]byte("huge")); ok {
+		t.Errorf("Expected an entry larger than the cache to be rejected")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestGhostHitsAdaptTarget(t *testing.T) {
+	entrySize := int64(len("key00") + 8 + 10)
+	cache := NewARCCache(10*entrySize, 1)
+	value := make([]byte, 8)
+
+	// Two entries in T2 leave T1 room for ghosts
+	for _, key := range []string{"a0000", "b0000"} {
+		cache.Set([]byte(key), value)
+		cache.Get([]byte(key))
+	}
+	for i := 0; i < 9; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%02d", i)), value)
+	}
+	idx, ok := cache.indexMap["key00"]
+	if !ok || cache.entries[idx].list != listB1 {
+		t.Fatalf("Expected key00 to be a ghost in B1")
+	}
+
+	// Coming back from B1 means T1 should have been larger
+	cache.Set([]byte("key00"), value)
+	if cache.target != entrySize {
+		t.Errorf("Expected a B1 hit to grow the target to %d, got %d", entrySize, cache.target)
+	}
+	checkInvariants(t, cache)
+
+	// With T1 below its target, T2 gives way and a0000 becomes a ghost in B2
+	for i := 2; i < 9; i++ {
+		cache.Get([]byte(fmt.Sprintf("key%02d", i)))
+	}
+	cache.Set([]byte("new00"), value)
+	cache.Set([]byte("new01"), value)
+	idx, ok = cache.indexMap["a0000"]
+	if !ok || cache.entries[idx].list != listB2 {
+		t.Fatalf("Expected a0000 to be a ghost in B2")
+	}
+
+	// Coming back from B2 means T2 should have been larger
+	cache.Set([]byte("a0000"), value)
+	if cache.target != 0 {
+		t.Errorf("Expected a B2 hit to shrink the target back to 0, got %d", cache.target)
+	}
+	checkInvariants(t, cache)
+}
+
+func TestFrequentEntriesSurviveScan(t *testing.T) {
+	entrySize := int64(len("hot00") + 8 + 10)
+	cache := NewARCCache(100*entrySize, 1)
+	value := make([]byte, 8)
+
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("hot%02d", i))
+		cache.Set(key, value)
+		cache.Get(key)
+	}
+	for i := 0; i < 10000; i++ {
+		cache.Set([]byte(fmt.Sprintf("s%04d", i)), value)
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := cache.Get([]byte(fmt.Sprintf("hot%02d", i))); !ok {
+			t.Fatalf("Expected hot%02d to survive a scan in T2", i)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestRandomOperations(t *testing.T) {
+	cache := NewARCCache(4096, 4)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(500)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, 1+rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSharded(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := cache.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	cache.Del([]byte("key1"))
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func BenchmarkCXARCBytesSet(b *testing.B) {
+	cache := NewARCCache(1024*100, 1)
+	keys := make([][]byte, 100000)
+	values := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+		values[i] = make([]byte, 1024) // 1 KB values
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i%100000], values[i%100000])
+	}
+}
+
+func BenchmarkCXARCBytesGet(b *testing.B) {
+	cache := NewARCCache(1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.Get(keys[i%100000])
+	}
+}
@@ -0,0 +1,213 @@
+package clockbytes
+
+import (
+	"sync"
+	"sync/atomic"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+const (
+	initialSlots = 64 // Starting ring capacity, doubled whenever it fills up
+	compactSlack = 64 // Deleted slots the ring tolerates beyond its live entries
+)
+
+// Cache is a memory bounded cache using the CLOCK eviction policy.
+//
+// Entries sit in a ring in insertion order, the oldest slot being under the clock hand. A Get
+// only sets the entry's reference bit, so hits are a map lookup plus a bit set under the read
+// lock with no list to maintain. On eviction the hand clears the bit of referenced entries and
+// moves them to the back of the ring, giving them a second chance, and evicts the first entry
+// that was not referenced since it last passed.
+type Cache struct {
+	maxMemory      int64
+	currentMemory  int64
+	evictBatchSize int
+	slots          []entry
+	hand           int // Oldest slot, the next eviction candidate
+	used           int // Slots in use from the hand onwards, deleted ones included
+	deleted        int
+	indexMap       map[string]int
+	mu             sync.RWMutex
+}
+
+type entry struct {
+	key, value []byte
+	referenced uint32 // Set by Get under the read lock, so always accessed atomically
+	deleted    bool   // Removed by Del, the slot is reclaimed when the hand reaches it
+}
+
+func NewClockCache(maxMemory int64, evictBatchSize int) *Cache {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	return &Cache{
+		maxMemory:      maxMemory,
+		evictBatchSize: evictBatchSize,
+		slots:          make([]entry, initialSlots),
+		indexMap:       make(map[string]int),
+	}
+}
+
+func (c *Cache) estimateMemory(key, value []byte) int64 {
+	return int64(len(key) + len(value) + 10) // Adding constant overhead for index
+}
+
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	c.mu.RLock()
+	idx, ok := c.indexMap[cx.B2s(key)]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	e := &c.slots[idx]
+	if atomic.LoadUint32(&e.referenced) == 0 {
+		atomic.StoreUint32(&e.referenced, 1)
+	}
+	value := e.value
+	c.mu.RUnlock()
+	return value, true
+}
+
+func (c *Cache) Set(key, value []byte) error {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx, ok := c.indexMap[keyStr]; ok {
+		// An update counts as a hit and keeps the entry's place in the ring
+		if memSize > c.maxMemory {
+			c.remove(idx)
+			return nil
+		}
+		e := &c.slots[idx]
+		c.currentMemory += memSize - c.estimateMemory(e.key, e.value)
+		// Re-insert so the map key refers to the newly stored key slice
+		delete(c.indexMap, keyStr)
+		e.key = key
+		e.value = value
+		c.indexMap[keyStr] = idx
+		atomic.StoreUint32(&e.referenced, 1)
+
+		// A value that grew may push the cache over its limit. Evict one entry at a time, passing
+		// over the entry just updated, rather than a whole batch that could take it along
+		for c.currentMemory > c.maxMemory && c.evictOne(keyStr) {
+		}
+		return nil
+	}
+
+	if memSize > c.maxMemory {
+		return nil
+	}
+	for c.currentMemory+memSize > c.maxMemory && c.evict(keyStr) {
+	}
+	if c.currentMemory+memSize > c.maxMemory {
+		return nil
+	}
+
+	c.indexMap[keyStr] = c.push(entry{key: key, value: value})
+	c.currentMemory += memSize
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	c.mu.Lock()
+	if idx, ok := c.indexMap[cx.B2s(key)]; ok {
+		c.remove(idx)
+	}
+	c.mu.Unlock()
+}
+
+// evict removes up to evictBatchSize unreferenced entries other than keep, it reports false once
+// nothing else is left
+func (c *Cache) evict(keep string) bool {
+	for i := 0; i < c.evictBatchSize; i++ {
+		if !c.evictOne(keep) {
+			return i > 0
+		}
+	}
+	return true
+}
+
+// evictOne advances the hand until it evicts an entry other than the one keyed keep, terminating
+// within one lap since every referenced entry passed gets its bit cleared
+func (c *Cache) evictOne(keep string) bool {
+	for c.used > c.deleted {
+		e := c.pop()
+		if e.deleted {
+			c.deleted--
+			continue
+		}
+		if cx.B2s(e.key) == keep {
+			c.indexMap[keep] = c.push(e)
+			if c.used-c.deleted == 1 {
+				return false // Nothing else left to evict
+			}
+			continue
+		}
+		if atomic.LoadUint32(&e.referenced) != 0 {
+			e.referenced = 0
+			c.indexMap[cx.B2s(e.key)] = c.push(e)
+			continue
+		}
+		c.currentMemory -= c.estimateMemory(e.key, e.value)
+		delete(c.indexMap, cx.B2s(e.key))
+		return true
+	}
+	return false
+}
+
+// remove releases the entry at idx and leaves a deleted slot behind, caller must hold the write lock
+func (c *Cache) remove(idx int) {
+	e := &c.slots[idx]
+	c.currentMemory -= c.estimateMemory(e.key, e.value)
+	delete(c.indexMap, cx.B2s(e.key))
+	c.slots[idx] = entry{deleted: true} // Drop the references so the GC can reclaim them
+	c.deleted++
+
+	if c.deleted > c.used-c.deleted+compactSlack {
+		c.resize(len(c.slots))
+	}
+}
+
+// push appends an entry behind the newest slot, growing the ring when it is full
+func (c *Cache) push(e entry) int {
+	if c.used == len(c.slots) {
+		c.resize(2 * len(c.slots))
+	}
+	idx := (c.hand + c.used) % len(c.slots)
+	c.slots[idx] = e
+	c.used++
+	return idx
+}
+
+// pop takes the entry under the hand out of the ring and moves the hand on
+func (c *Cache) pop() entry {
+	e := c.slots[c.hand]
+	c.slots[c.hand] = entry{}
+	c.hand = (c.hand + 1) % len(c.slots)
+	c.used--
+	return e
+}
+
+// resize copies the live entries in ring order into a new ring starting at slot 0, dropping
+// deleted slots and reindexing every key
+func (c *Cache) resize(capacity int) {
+	slots := make([]entry, capacity)
+	n := 0
+	for i := 0; i < c.used; i++ {
+		e := c.slots[(c.hand+i)%len(c.slots)]
+		if e.deleted {
+			continue
+		}
+		slots[n] = e
+		c.indexMap[cx.B2s(e.key)] = n
+		n++
+	}
+	c.slots = slots
+	c.hand = 0
+	c.used = n
+	c.deleted = 0
+}
@@ -0,0 +1,50 @@
+package clockbytes
+
+import (
+	"fmt"
+
+	"github.com/zeebo/xxh3"
+)
+
+// ShardedCache struct containing multiple Cache shards
+type ShardedCache struct {
+	shards     []*Cache
+	shardCount uint8
+}
+
+// NewShardedCache creates a new ShardedCache with the specified number of shards, total memory limit, and eviction count
+func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int) *ShardedCache {
+	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
+		panic(fmt.Errorf("cxclockbytes shardCount must be a non-zero power of 2, got %d", shardCount))
+	}
+	maxMemoryPerShard := totalMemory / int64(shardCount)
+	shards := make([]*Cache, shardCount)
+	for i := uint8(0); i < shardCount; i++ {
+		shards[i] = NewClockCache(maxMemoryPerShard, evictionCount)
+	}
+	return &ShardedCache{
+		shards:     shards,
+		shardCount: shardCount,
+	}
+}
+
+// getShard computes the hash of the key to determine which shard to use
+func (sc *ShardedCache) getShard(key []byte) *Cache {
+	hash := xxh3.Hash(key)
+	return sc.shards[uint8(hash)&(sc.shardCount-1)]
+}
+
+// Get retrieves a value from the appropriate shard
+func (sc *ShardedCache) Get(key []byte) ([]byte, bool) {
+	return sc.getShard(key).Get(key)
+}
+
+// Set adds a key-value pair to the appropriate shard
+func (sc *ShardedCache) Set(key, value []byte) {
+	sc.getShard(key).Set(key, value)
+}
+
+// Del removes a key from the appropriate shard
+func (sc *ShardedCache) Del(key []byte) {
+	sc.getShard(key).Del(key)
+}
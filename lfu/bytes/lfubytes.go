@@ -0,0 +1,323 @@
+package lfubytes
+
+import (
+	"sync"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// Cache is a memory bounded least frequently used cache.
+//
+// Entries are grouped into frequency buckets kept in ascending order, every bucket being a
+// recency ordered list. A hit moves the entry to the front of the next bucket and eviction
+// takes the least recently used entry of the lowest bucket, so both are O(1). With WithDecay
+// all frequencies are halved periodically so entries that used to be popular can age out.
+type Cache struct {
+	maxMemory      int64
+	currentMemory  int64
+	evictBatchSize int
+	entries        []entry
+	freeEntries    []int // Stack of indices of free entries
+	indexMap       map[string]int
+	lowest         *bucket   // Bucket with the lowest frequency, nil when empty
+	freeBuckets    []*bucket // Emptied buckets kept for reuse
+	decayInterval  time.Duration
+	nextDecay      int64 // Unix nanoseconds of the next decay, 0 without decay
+	mu             sync.Mutex
+}
+
+type entry struct {
+	key, value []byte
+	bucket     *bucket
+	prev, next int // prev is towards the most recently used end
+}
+
+// bucket holds every entry with the same frequency
+type bucket struct {
+	freq       uint32
+	head, tail int // Most and least recently used
+	prev, next *bucket
+}
+
+// Option configures a Cache at construction time
+type Option func(*Cache)
+
+// WithDecay halves the frequency of every entry once per interval, checked lazily on Get and Set.
+// Buckets merged by the halving keep the more frequent entries in front.
+func WithDecay(interval time.Duration) Option {
+	return func(c *Cache) {
+		c.decayInterval = interval
+		c.nextDecay = time.Now().Add(interval).UnixNano()
+	}
+}
+
+func NewLFUCache(maxMemory int64, evictBatchSize int, opts ...Option) *Cache {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	c := &Cache{
+		maxMemory:      maxMemory,
+		evictBatchSize: evictBatchSize,
+		entries:        make([]entry, 0),
+		freeEntries:    make([]int, 0),
+		indexMap:       make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Cache) estimateMemory(key, value []byte) int64 {
+	return int64(len(key) + len(value) + 10) // Adding constant overhead for index
+}
+
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	c.mu.Lock()
+	c.maybeDecay()
+	idx, ok := c.indexMap[cx.B2s(key)]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.touch(idx)
+	value := c.entries[idx].value
+	c.mu.Unlock()
+	return value, true
+}
+
+func (c *Cache) Set(key, value []byte) error {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maybeDecay()
+
+	if idx, ok := c.indexMap[keyStr]; ok {
+		// An update counts as a use of the entry
+		if memSize > c.maxMemory {
+			c.remove(idx)
+			return nil
+		}
+		e := &c.entries[idx]
+		c.currentMemory += memSize - c.estimateMemory(e.key, e.value)
+		// Re-insert so the map key refers to the newly stored key slice
+		delete(c.indexMap, keyStr)
+		e.key = key
+		e.value = value
+		c.indexMap[keyStr] = idx
+		c.touch(idx)
+
+		// A value that grew may push the cache over its limit. Evict one entry at a time, passing
+		// over the entry just updated, rather than a whole batch that could take it along
+		for c.currentMemory > c.maxMemory {
+			victim := c.victim(idx)
+			if victim == -1 {
+				break
+			}
+			c.remove(victim)
+		}
+		return nil
+	}
+
+	if memSize > c.maxMemory {
+		return nil
+	}
+	for c.currentMemory+memSize > c.maxMemory && c.evict() {
+	}
+	if c.currentMemory+memSize > c.maxMemory {
+		return nil
+	}
+
+	var idx int
+	if len(c.freeEntries) > 0 {
+		idx = c.freeEntries[len(c.freeEntries)-1]
+		c.freeEntries = c.freeEntries[:len(c.freeEntries)-1]
+	} else {
+		c.entries = append(c.entries, entry{})
+		idx = len(c.entries) - 1
+	}
+	c.entries[idx] = entry{key: key, value: value, prev: -1, next: -1}
+
+	// New entries start with a frequency of 1, in front of the lowest bucket
+	first := c.lowest
+	if first == nil || first.freq != 1 {
+		first = c.newBucket(1, nil, c.lowest)
+	}
+	c.linkFront(idx, first)
+
+	c.indexMap[keyStr] = idx
+	c.currentMemory += memSize
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	c.mu.Lock()
+	if idx, ok := c.indexMap[cx.B2s(key)]; ok {
+		c.remove(idx)
+	}
+	c.mu.Unlock()
+}
+
+// touch moves an entry to the front of the bucket one frequency up
+func (c *Cache) touch(idx int) {
+	from := c.entries[idx].bucket
+	to := from.next
+	if to == nil || to.freq != from.freq+1 {
+		to = c.newBucket(from.freq+1, from, from.next)
+	}
+	c.unlink(idx)
+	c.linkFront(idx, to)
+}
+
+// evict removes up to evictBatchSize least frequently used entries, it reports false once the cache is empty
+func (c *Cache) evict() bool {
+	for i := 0; i < c.evictBatchSize; i++ {
+		if c.lowest == nil {
+			return i > 0
+		}
+		c.remove(c.lowest.tail)
+	}
+	return true
+}
+
+// victim returns the least frequently used entry other than keep, -1 if there is none
+func (c *Cache) victim(keep int) int {
+	b := c.lowest
+	if b == nil {
+		return -1
+	}
+	if b.tail != keep {
+		return b.tail
+	}
+	if prev := c.entries[keep].prev; prev != -1 {
+		return prev
+	}
+	if b.next != nil {
+		return b.next.tail
+	}
+	return -1
+}
+
+// remove unlinks the entry at idx and frees its slot, caller must hold the lock
+func (c *Cache) remove(idx int) {
+	c.unlink(idx)
+	e := &c.entries[idx]
+	c.currentMemory -= c.estimateMemory(e.key, e.value)
+	delete(c.indexMap, cx.B2s(e.key))
+	c.entries[idx] = entry{prev: -1, next: -1} // Drop the references so the GC can reclaim them
+	c.freeEntries = append(c.freeEntries, idx)
+}
+
+// linkFront inserts an unlinked entry as the most recently used of a bucket
+func (c *Cache) linkFront(idx int, b *bucket) {
+	e := &c.entries[idx]
+	e.bucket = b
+	e.prev = -1
+	e.next = b.head
+	if b.head != -1 {
+		c.entries[b.head].prev = idx
+	}
+	b.head = idx
+	if b.tail == -1 {
+		b.tail = idx
+	}
+}
+
+// unlink takes an entry out of its bucket, dropping the bucket once it is empty
+func (c *Cache) unlink(idx int) {
+	e := &c.entries[idx]
+	b := e.bucket
+	if e.prev != -1 {
+		c.entries[e.prev].next = e.next
+	} else {
+		b.head = e.next
+	}
+	if e.next != -1 {
+		c.entries[e.next].prev = e.prev
+	} else {
+		b.tail = e.prev
+	}
+	e.prev = -1
+	e.next = -1
+	e.bucket = nil
+
+	if b.head == -1 {
+		c.dropBucket(b)
+	}
+}
+
+// newBucket links an empty bucket between prev and next, either may be nil
+func (c *Cache) newBucket(freq uint32, prev, next *bucket) *bucket {
+	var b *bucket
+	if n := len(c.freeBuckets); n > 0 {
+		b = c.freeBuckets[n-1]
+		c.freeBuckets = c.freeBuckets[:n-1]
+	} else {
+		b = &bucket{}
+	}
+	*b = bucket{freq: freq, head: -1, tail: -1, prev: prev, next: next}
+	if prev != nil {
+		prev.next = b
+	} else {
+		c.lowest = b
+	}
+	if next != nil {
+		next.prev = b
+	}
+	return b
+}
+
+func (c *Cache) dropBucket(b *bucket) {
+	if b.prev != nil {
+		b.prev.next = b.next
+	} else {
+		c.lowest = b.next
+	}
+	if b.next != nil {
+		b.next.prev = b.prev
+	}
+	*b = bucket{}
+	c.freeBuckets = append(c.freeBuckets, b)
+}
+
+func (c *Cache) maybeDecay() {
+	if c.nextDecay == 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	if now < c.nextDecay {
+		return
+	}
+	c.decay()
+	c.nextDecay = now + int64(c.decayInterval)
+}
+
+// decay halves every frequency, never below 1. Buckets landing on the same frequency are
+// merged with the formerly more frequent entries in front, so it is O(entries).
+func (c *Cache) decay() {
+	var kept *bucket // Highest bucket kept so far
+	for b := c.lowest; b != nil; {
+		next := b.next
+		freq := max(b.freq/2, 1)
+		if kept == nil || kept.freq != freq {
+			b.freq = freq
+			kept = b
+			b = next
+			continue
+		}
+
+		// Splice b in front of kept, both are adjacent so kept becomes the last bucket again
+		for idx := b.head; idx != -1; idx = c.entries[idx].next {
+			c.entries[idx].bucket = kept
+		}
+		c.entries[b.tail].next = kept.head
+		c.entries[kept.head].prev = b.tail
+		kept.head = b.head
+		b.head, b.tail = -1, -1
+		c.dropBucket(b)
+		b = next
+	}
+}
@@ -0,0 +1,240 @@
+package lfubytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// checkInvariants verifies the buckets, index, free slots and memory accounting agree
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var memory int64
+	linked := 0
+	var prevBucket *bucket
+	for b := c.lowest; b != nil; b = b.next {
+		if b.prev != prevBucket || b.head == -1 {
+			t.Fatalf("Bucket %d is empty or badly linked", b.freq)
+		}
+		if prevBucket != nil && prevBucket.freq >= b.freq {
+			t.Fatalf("Bucket %d follows bucket %d", b.freq, prevBucket.freq)
+		}
+		prev := -1
+		for idx := b.head; idx != -1; idx = c.entries[idx].next {
+			e := c.entries[idx]
+			if e.bucket != b || e.prev != prev {
+				t.Fatalf("Entry %d is badly linked in bucket %d", idx, b.freq)
+			}
+			if c.indexMap[string(e.key)] != idx {
+				t.Fatalf("Index of %q does not point at entry %d", e.key, idx)
+			}
+			memory += c.estimateMemory(e.key, e.value)
+			prev = idx
+			linked++
+		}
+		if b.tail != prev {
+			t.Fatalf("Bucket %d tail is %d, expected %d", b.freq, b.tail, prev)
+		}
+		prevBucket = b
+	}
+	if linked != len(c.indexMap) || linked+len(c.freeEntries) != len(c.entries) {
+		t.Fatalf("%d linked, %d indexed, %d free of %d slots", linked, len(c.indexMap), len(c.freeEntries), len(c.entries))
+	}
+	if memory != c.currentMemory || memory > c.maxMemory {
+		t.Fatalf("Entries hold %d bytes, currentMemory %d, maxMemory %d", memory, c.currentMemory, c.maxMemory)
+	}
+}
+
+func freq(c *Cache, key string) uint32 {
+	return c.entries[c.indexMap[key]].bucket.freq
+}
+
+func TestGetSetDel(t *testing.T) {
+	cache := NewLFUCache(1024, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	if got := freq(cache, "a"); got != 4 {
+		t.Errorf("Expected a to have been used 4 times, got %d", got)
+	}
+	cache.Del([]byte("a"))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	cache.Set([]byte("huge"), make([]byte, 2048))
+	if _, ok := cache.Get([]byte("huge")); ok {
+		t.Errorf("Expected an entry larger than the cache to be rejected")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestEvictsLeastFrequentThenLeastRecent(t *testing.T) {
+	entrySize := int64(1 + 1 + 10)
+	cache := NewLFUCache(3*entrySize, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Get([]byte("a"))
+	cache.Get([]byte("a"))
+	cache.Get([]byte("c"))
+
+	// b is the least frequently used
+	cache.Set([]byte("d"), []byte("4"))
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+
+	// c and d tie at 2 uses after this Get, c was used less recently
+	cache.Get([]byte("d"))
+	cache.Set([]byte("e"), []byte("5"))
+	cache.Get([]byte("e"))
+	if _, ok := cache.Get([]byte("c")); ok {
+		t.Errorf("Expected c to be evicted")
+	}
+	for _, key := range []string{"a", "d", "e"} {
+		if _, ok := cache.Get([]byte(key)); !ok {
+			t.Errorf("Expected %s to survive", key)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestDecay(t *testing.T) {
+	cache := NewLFUCache(1024, 1, WithDecay(10*time.Millisecond))
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	for i := 0; i < 9; i++ {
+		cache.Get([]byte("a"))
+	}
+	for i := 0; i < 4; i++ {
+		cache.Get([]byte("b"))
+	}
+	cache.Get([]byte("c"))
+
+	time.Sleep(20 * time.Millisecond)
+	cache.Set([]byte("d"), []byte("4")) // Triggers the decay
+
+	for key, want := range map[string]uint32{"a": 5, "b": 2, "c": 1, "d": 1} {
+		if got := freq(cache, key); got != want {
+			t.Errorf("Expected %s to have frequency %d after decay, got %d", key, want, got)
+		}
+	}
+	// c decayed into the frequency 1 bucket before d was set, so it is the older of the two
+	if cache.lowest.tail != cache.indexMap["c"] {
+		t.Errorf("Expected c to be the first eviction candidate after decay")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestOverwriteBatchEviction(t *testing.T) {
+	cache := NewLFUCache(100, 4)
+	cache.Set([]byte("a"), make([]byte, 29))
+	cache.Set([]byte("b"), make([]byte, 29))
+
+	// Growing a to 80 bytes needs b gone, a batch of 4 must not take a along
+	cache.Set([]byte("a"), make([]byte, 69))
+	if value, ok := cache.Get([]byte("a")); !ok || len(value) != 69 {
+		t.Errorf("Expected a to hold the larger value, got %d bytes, %v", len(value), ok)
+	}
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be evicted to make room for the larger a")
+	}
+	checkInvariants(t, cache)
+
+	// Every other entry used more often, so a stays the least frequently used while it grows
+	cache = NewLFUCache(1000, 4)
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		cache.Set(key, make([]byte, 20))
+		cache.Get(key)
+		cache.Get(key)
+	}
+	for i := 0; i < 60; i++ {
+		cache.Set([]byte("a"), make([]byte, 10*i))
+		if value, ok := cache.Get([]byte("a")); !ok || len(value) != 10*i {
+			t.Fatalf("Expected a to hold %d bytes, got %d, %v", 10*i, len(value), ok)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestRandomOperations(t *testing.T) {
+	cache := NewLFUCache(4096, 4)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(500)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+		if i%10000 == 0 {
+			cache.decay()
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSharded(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1, WithDecay(time.Minute))
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := cache.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	cache.Del([]byte("key1"))
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func BenchmarkCXLFUBytesSet(b *testing.B) {
+	cache := NewLFUCache(1024*100, 1)
+	keys := make([][]byte, 100000)
+	values := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+		values[i] = make([]byte, 1024) // 1 KB values
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i%100000], values[i%100000])
+	}
+}
+
+func BenchmarkCXLFUBytesGet(b *testing.B) {
+	cache := NewLFUCache(1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.Get(keys[i%100000])
+	}
+}
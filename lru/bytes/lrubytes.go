@@ -24,8 +24,10 @@ package lrubytes
 import (
     "sync"
     "sync/atomic"
+    "time"
 
     cx "github.com/cloudxaas/gocx"
+    "github.com/zeebo/xxh3"
 )
 
 type Cache struct {
@@ -34,31 +36,68 @@ type Cache struct {
     evictBatchSize int
     entries        map[uint64]entry
     indexMap       map[string]uint64
-    head, tail     uint64
+    lists          [segmentCount]list // Plain LRU only uses segmentLRU
     mu             sync.RWMutex
     indexCounter   uint64
+    defaultTTL     time.Duration
+    sweeper        sweeper
+    onEvict        EvictFunc
+    pending        []evicted // Removals waiting to be reported once the lock is released
+    stats          counters
+    sketch         *frequencySketch // Set when W-TinyLFU admission is enabled
+    windowMax      int64            // Memory of the W-TinyLFU admission window
+    protectedMax   int64            // Memory of the protected segment, 0 without one
+    loads          loadGroup        // In-flight GetOrLoad calls and cached loader errors
+    copyOnSet      bool             // Set stores copies instead of the caller's slices
+    tagIndex       map[string]map[uint64]struct{} // Tag to the entries carrying it, see SetWithTags
+    entryTags      map[uint64][]string            // Tags of every tagged entry
 }
 
 type entry struct {
     key, value []byte
-    index      uint8
+    segment    uint8 // List the entry is linked into
     prev, next uint64
+    expireAt   int64 // Unix nanoseconds, 0 means the entry never expires
+}
+
+// list is one recency ordered segment of the cache, head is the most recently used
+type list struct {
+    head, tail uint64
+    memory     int64
 }
 
+const (
+    segmentLRU       = iota // The whole cache under plain LRU, the admission window under W-TinyLFU
+    segmentProbation        // Entries seen once, evicted first
+    segmentProtected        // Entries hit again while in probation
+    segmentCount
+)
+
+// segmentOrder lists the segments from most to least valuable
+var segmentOrder = [segmentCount]uint8{segmentLRU, segmentProtected, segmentProbation}
+
 const (
     InvalidIndex = ^uint64(0) // Max value for uint64 to represent an invalid index
 )
 
-func NewLRUCache(maxMemory int64, evictBatchSize int) *Cache {
-    return &Cache{
+// Option configures a Cache at construction time
+type Option func(*Cache)
+
+func NewLRUCache(maxMemory int64, evictBatchSize int, opts ...Option) *Cache {
+    c := &Cache{
         maxMemory:      maxMemory,
         evictBatchSize: evictBatchSize,
         entries:        make(map[uint64]entry),
         indexMap:       make(map[string]uint64),
-        head:           InvalidIndex,
-        tail:           InvalidIndex,
         indexCounter:   0,
     }
+    for i := range c.lists {
+        c.lists[i] = list{head: InvalidIndex, tail: InvalidIndex}
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
 }
 
 func (c *Cache) estimateMemory(key, value []byte) int64 {
@@ -71,51 +110,126 @@ func (c *Cache) adjustMemory(delta int64) {
 
 func (c *Cache) Get(key []byte) ([]byte, bool) {
     keyStr := cx.B2s(key)
-    
-    c.mu.RLock()
-    idx, ok := c.indexMap[keyStr]
-    if !ok {
+
+    // Frequency tracking needs the write lock on every access, otherwise a hit on
+    // the head of a list only needs the read lock
+    if c.sketch == nil {
+        c.mu.RLock()
+        idx, ok := c.indexMap[keyStr]
+        if !ok {
+            c.mu.RUnlock()
+            c.stats.misses.Add(1)
+            return nil, false
+        }
+        entry := c.entries[idx]
+        if idx == c.lists[entry.segment].head && entry.segment != segmentProbation && !entry.expired() {
+            c.mu.RUnlock()
+            c.stats.hits.Add(1)
+            return entry.value, true
+        }
         c.mu.RUnlock()
-        return nil, false
     }
 
-    if idx != c.head {
-        c.mu.RUnlock()
-        c.mu.Lock()
-        c.moveToFront(idx)
+    // Upgrade to the write lock, the entry may have changed in between
+    c.mu.Lock()
+    if c.sketch != nil {
+        c.sketch.increment(xxh3.Hash(key))
+    }
+    idx, ok := c.indexMap[keyStr]
+    if !ok {
         c.mu.Unlock()
-    } else {
-        c.mu.RUnlock()
+        c.stats.misses.Add(1)
+        return nil, false
     }
-    
-    c.mu.RLock()
     entry := c.entries[idx]
-    c.mu.RUnlock()
-    
+    if entry.expired() {
+        c.remove(idx, EvictExpired)
+        evicted := c.takeEvicted()
+        c.mu.Unlock()
+        c.stats.misses.Add(1)
+        c.notifyEvicted(evicted)
+        return nil, false
+    }
+    c.touch(idx)
+    c.mu.Unlock()
+
+    c.stats.hits.Add(1)
     return entry.value, true
 }
 
+// touch records a hit, entries in probation are promoted to the protected segment
+func (c *Cache) touch(idx uint64) {
+    if c.entries[idx].segment != segmentProbation {
+        c.moveToFront(idx)
+        return
+    }
+    c.detach(idx)
+    c.linkFront(idx, segmentProtected)
+
+    // Demote the least recently used protected entries back to probation when it overflows
+    protected := &c.lists[segmentProtected]
+    for protected.memory > c.protectedMax && protected.tail != InvalidIndex {
+        tailIdx := protected.tail
+        c.detach(tailIdx)
+        c.linkFront(tailIdx, segmentProbation)
+    }
+}
+
 func (c *Cache) moveToFront(idx uint64) {
-    if idx == InvalidIndex || idx == c.head {
+    if idx == InvalidIndex {
+        return
+    }
+    segment := c.entries[idx].segment
+    if idx == c.lists[segment].head {
         return
     }
 
-    entry := c.entries[idx]
     c.detach(idx)
+    c.linkFront(idx, segment)
+}
 
+// linkFront inserts an unlinked entry at the head of a segment
+func (c *Cache) linkFront(idx uint64, segment uint8) {
+    l := &c.lists[segment]
+    entry := c.entries[idx]
+
+    entry.segment = segment
     entry.prev = InvalidIndex
-    entry.next = c.head
-    if c.head != InvalidIndex {
-        headEntry := c.entries[c.head]
+    entry.next = l.head
+    if l.head != InvalidIndex {
+        headEntry := c.entries[l.head]
         headEntry.prev = idx
-        c.entries[c.head] = headEntry
+        c.entries[l.head] = headEntry
     }
-    c.head = idx
+    l.head = idx
     c.entries[idx] = entry
 
-    if c.tail == InvalidIndex {
-        c.tail = idx
+    if l.tail == InvalidIndex {
+        l.tail = idx
     }
+    l.memory += c.estimateMemory(entry.key, entry.value)
+}
+
+// linkBack inserts an unlinked entry at the tail of a segment
+func (c *Cache) linkBack(idx uint64, segment uint8) {
+    l := &c.lists[segment]
+    entry := c.entries[idx]
+
+    entry.segment = segment
+    entry.prev = l.tail
+    entry.next = InvalidIndex
+    if l.tail != InvalidIndex {
+        tailEntry := c.entries[l.tail]
+        tailEntry.next = idx
+        c.entries[l.tail] = tailEntry
+    }
+    l.tail = idx
+    c.entries[idx] = entry
+
+    if l.head == InvalidIndex {
+        l.head = idx
+    }
+    l.memory += c.estimateMemory(entry.key, entry.value)
 }
 
 func (c *Cache) detach(idx uint64) {
@@ -124,12 +238,13 @@ func (c *Cache) detach(idx uint64) {
     }
 
     entry := c.entries[idx]
+    l := &c.lists[entry.segment]
     if entry.prev != InvalidIndex {
         prevEntry := c.entries[entry.prev]
         prevEntry.next = entry.next
         c.entries[entry.prev] = prevEntry
     } else {
-        c.head = entry.next
+        l.head = entry.next
     }
 
     if entry.next != InvalidIndex {
@@ -137,44 +252,59 @@ func (c *Cache) detach(idx uint64) {
         nextEntry.prev = entry.prev
         c.entries[entry.next] = nextEntry
     } else {
-        c.tail = entry.prev
+        l.tail = entry.prev
     }
+    l.memory -= c.estimateMemory(entry.key, entry.value)
 
     entry.prev = InvalidIndex
     entry.next = InvalidIndex
     c.entries[idx] = entry
 }
 
-func (c *Cache) evict(entrySize int64) {
-    evicted := false
-    attempts := 0
-
-    for atomic.LoadInt64(&c.currentMemory)+entrySize > c.maxMemory && c.tail != InvalidIndex {
-        tailIdx := c.tail
-
-        if tailIdx == InvalidIndex {
-            break
-        }
+// remove unlinks the entry at idx and releases its memory, caller must hold the write lock
+func (c *Cache) remove(idx uint64, reason EvictReason) {
+    entry := c.entries[idx]
+    if c.onEvict != nil {
+        c.pending = append(c.pending, evicted{key: entry.key, value: entry.value, reason: reason})
+    }
+    c.stats.record(reason)
+    c.adjustMemory(-c.estimateMemory(entry.key, entry.value))
+    if c.entryTags != nil {
+        c.untag(idx)
+    }
 
-        oldKeyStr := cx.B2s(c.entries[tailIdx].key)
-        memSize := c.estimateMemory(c.entries[tailIdx].key, c.entries[tailIdx].value)
-        c.adjustMemory(-memSize)
+    c.detach(idx)
 
-        c.detach(tailIdx)
+    delete(c.indexMap, cx.B2s(entry.key))
+    delete(c.entries, idx)
+}
 
-        delete(c.indexMap, oldKeyStr)
-        delete(c.entries, tailIdx)
-        evicted = true
-        attempts++
+// victim returns the next entry to evict, probation drains before protected
+func (c *Cache) victim() uint64 {
+    for _, segment := range [...]uint8{segmentLRU, segmentProbation, segmentProtected} {
+        if c.lists[segment].tail != InvalidIndex {
+            return c.lists[segment].tail
+        }
+    }
+    return InvalidIndex
+}
 
-        if attempts > len(c.entries) {
-            break
+func (c *Cache) evict(entrySize int64) {
+    for atomic.LoadInt64(&c.currentMemory)+entrySize > c.maxMemory {
+        victim := c.victim()
+        if victim == InvalidIndex {
+            return
         }
+        c.remove(victim, EvictCapacity)
     }
+}
 
-    if !evicted {
-        return
+// insertSegment is where new entries start: the window under W-TinyLFU, probation with a protected segment
+func (c *Cache) insertSegment() uint8 {
+    if c.sketch == nil && c.protectedMax > 0 {
+        return segmentProbation
     }
+    return segmentLRU
 }
 
 func (c *Cache) wrapIndexCounter() {
@@ -183,67 +313,85 @@ func (c *Cache) wrapIndexCounter() {
     }
 }
 
+// Set stores the value under key, using the default TTL if one was configured
 func (c *Cache) Set(key, value []byte) error {
-    keyStr := cx.B2s(key)
+    return c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL stores the value under key, expiring it after ttl. A ttl of 0 or less never expires.
+func (c *Cache) SetWithTTL(key, value []byte, ttl time.Duration) error {
     memSize := c.estimateMemory(key, value)
+    if c.copyOnSet {
+        key, value = clone(key, value)
+    }
 
-    c.wrapIndexCounter()
+    var expireAt int64
+    if ttl > 0 {
+        expireAt = time.Now().Add(ttl).UnixNano()
+    }
 
     c.mu.Lock()
-    defer c.mu.Unlock()
+    c.set(key, value, nil, memSize, expireAt)
+    evicted := c.takeEvicted()
+    c.mu.Unlock()
 
-    for atomic.LoadInt64(&c.currentMemory)+memSize > c.maxMemory && c.tail != InvalidIndex {
-        c.evict(memSize)
+    c.notifyEvicted(evicted)
+    return nil
+}
+
+func (c *Cache) set(key, value []byte, tags []string, memSize, expireAt int64) {
+    keyStr := cx.B2s(key)
+
+    // Drop the old entry first so its memory is released before making room for the new one
+    if idx, ok := c.indexMap[keyStr]; ok {
+        c.remove(idx, EvictReplaced)
     }
 
-    if atomic.LoadInt64(&c.currentMemory)+memSize > c.maxMemory {
-        return nil
+    // An entry larger than the whole cache would only flush everything else before being dropped
+    if memSize > c.maxMemory {
+        c.stats.rejected.Add(1)
+        return
     }
 
-    if idx, ok := c.indexMap[keyStr]; ok {
-        entry := c.entries[idx]
-        entry.value = value
-        c.entries[idx] = entry
-        c.moveToFront(idx)
-    } else {
-        entry := entry{key: key, value: value, index: 0, prev: InvalidIndex, next: c.head}
-        c.entries[c.indexCounter] = entry
-        c.indexMap[keyStr] = c.indexCounter
-
-        if c.head != InvalidIndex {
-            headEntry := c.entries[c.head]
-            headEntry.prev = c.indexCounter
-            c.entries[c.head] = headEntry
-        }
-        c.head = c.indexCounter
+    // W-TinyLFU always takes new entries into the window and decides what to keep on admission
+    if c.sketch == nil {
+        c.evict(memSize)
 
-        if c.tail == InvalidIndex {
-            c.tail = c.indexCounter
+        if atomic.LoadInt64(&c.currentMemory)+memSize > c.maxMemory {
+            c.stats.rejected.Add(1)
+            return
         }
+    }
+
+    c.wrapIndexCounter()
 
-        c.indexCounter++
+    idx := c.indexCounter
+    c.entries[idx] = entry{key: key, value: value, prev: InvalidIndex, next: InvalidIndex, expireAt: expireAt}
+    c.indexMap[keyStr] = idx
+    c.linkFront(idx, c.insertSegment())
+    if len(tags) > 0 {
+        c.tag(idx, tags)
     }
 
+    c.indexCounter++
+
     c.adjustMemory(memSize)
-    return nil
+    c.stats.sets.Add(1)
+
+    if c.sketch != nil {
+        c.sketch.increment(xxh3.Hash(key))
+        c.admit()
+    }
 }
 
 func (c *Cache) Del(key []byte) {
     keyStr := cx.B2s(key)
     c.mu.Lock()
-    defer c.mu.Unlock()
-
     if idx, ok := c.indexMap[keyStr]; ok {
-        entry := c.entries[idx]
-
-        memSize := c.estimateMemory(entry.key, entry.value)
-        c.adjustMemory(-memSize)
-
-        c.detach(idx)
-
-        delete(c.entries, idx)
-        delete(c.indexMap, keyStr)
+        c.remove(idx, EvictDeleted)
     }
-}
-
+    evicted := c.takeEvicted()
+    c.mu.Unlock()
 
+    c.notifyEvicted(evicted)
+}
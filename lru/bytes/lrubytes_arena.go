@@ -0,0 +1,246 @@
+package lrubytes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Arena entry layout: hash (8) | key len (4) | value len (4) | flags (1) | key | value
+const (
+	arenaHeader = 17
+	arenaFlags  = 16 // Offset of the flags byte in the header
+
+	flagAccessed = 1 << 0 // Read since it was written or last given a second chance
+	flagDeleted  = 1 << 1 // Overwritten or deleted, its bytes are reclaimed when the tail passes
+)
+
+// ArenaCache copies keys and values into one preallocated byte ring instead of keeping the
+// caller's slices, and indexes them by xxh3 hash to ring offset. Neither the ring nor the index
+// holds pointers, so the GC scans a handful of objects however many entries are cached.
+//
+// Entries are appended at the head of the ring and reclaimed from its tail like a log. An entry
+// read since it was written gets a second chance and is moved to the head instead of being
+// evicted, approximating LRU. Overwritten and deleted entries keep their bytes until the tail
+// reaches them. Get returns a copy of the value since the ring is reused, so unlike Cache.Get it
+// allocates on every hit. Only GetInto with a dst reused across calls reads without allocating.
+type ArenaCache struct {
+	buf     []byte
+	head    uint64 // Where the next entry is written
+	tail    uint64 // Oldest entry
+	used    uint64 // Bytes between tail and head, dead entries included
+	index   map[uint64]uint64
+	scratch []byte // Holds an entry given a second chance while it moves
+	mu      sync.Mutex
+}
+
+func NewArenaCache(maxMemory int64) *ArenaCache {
+	return &ArenaCache{
+		buf:   make([]byte, maxMemory),
+		index: make(map[uint64]uint64),
+	}
+}
+
+// arenaEntry is a decoded header
+type arenaEntry struct {
+	hash             uint64
+	keyLen, valueLen uint32
+	flags            byte
+}
+
+func (e arenaEntry) size() uint64 {
+	return arenaHeader + uint64(e.keyLen) + uint64(e.valueLen)
+}
+
+// read copies len(dst) bytes starting at off, wrapping around the end of the ring
+func (c *ArenaCache) read(off uint64, dst []byte) {
+	n := copy(dst, c.buf[off:])
+	copy(dst[n:], c.buf)
+}
+
+// write copies data to off, wrapping around the end of the ring, and returns the offset after it
+func (c *ArenaCache) write(off uint64, data []byte) uint64 {
+	n := copy(c.buf[off:], data)
+	copy(c.buf, data[n:])
+	return (off + uint64(len(data))) % uint64(len(c.buf))
+}
+
+func (c *ArenaCache) at(off, delta uint64) uint64 {
+	return (off + delta) % uint64(len(c.buf))
+}
+
+func (c *ArenaCache) header(off uint64) arenaEntry {
+	var h [arenaHeader]byte
+	c.read(off, h[:])
+	return arenaEntry{
+		hash:     binary.LittleEndian.Uint64(h[0:]),
+		keyLen:   binary.LittleEndian.Uint32(h[8:]),
+		valueLen: binary.LittleEndian.Uint32(h[12:]),
+		flags:    h[arenaFlags],
+	}
+}
+
+func (c *ArenaCache) setFlags(off uint64, flags byte) {
+	c.buf[c.at(off, arenaFlags)] = flags
+}
+
+// keyEquals compares the key stored at off with key without copying it
+func (c *ArenaCache) keyEquals(off uint64, e arenaEntry, key []byte) bool {
+	if int(e.keyLen) != len(key) {
+		return false
+	}
+	start := c.at(off, arenaHeader)
+	n := min(uint64(len(key)), uint64(len(c.buf))-start)
+	return bytes.Equal(c.buf[start:start+n], key[:n]) && bytes.Equal(c.buf[:uint64(len(key))-n], key[n:])
+}
+
+// lookup finds the live entry of key, caller must hold the lock
+func (c *ArenaCache) lookup(key []byte) (uint64, arenaEntry, bool) {
+	off, ok := c.index[xxh3.Hash(key)]
+	if !ok {
+		return 0, arenaEntry{}, false
+	}
+	e := c.header(off)
+	if !c.keyEquals(off, e, key) {
+		return 0, arenaEntry{}, false // Another key with the same hash
+	}
+	return off, e, true
+}
+
+// Get returns a copy of the value of key, allocated on every hit, use GetInto on hot paths
+func (c *ArenaCache) Get(key []byte) ([]byte, bool) {
+	return c.GetInto(key, nil)
+}
+
+// GetInto appends the value of key to dst, reusing dst across calls reads without allocating
+func (c *ArenaCache) GetInto(key, dst []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	off, e, ok := c.lookup(key)
+	if !ok {
+		return dst, false
+	}
+	c.setFlags(off, e.flags|flagAccessed)
+	n := len(dst)
+	dst = slices.Grow(dst, int(e.valueLen))[:n+int(e.valueLen)]
+	c.read(c.at(off, arenaHeader+uint64(e.keyLen)), dst[n:])
+	return dst, true
+}
+
+func (c *ArenaCache) Set(key, value []byte) error {
+	size := arenaHeader + uint64(len(key)) + uint64(len(value))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if off, e, ok := c.lookup(key); ok {
+		c.setFlags(off, e.flags|flagDeleted)
+		delete(c.index, e.hash)
+	}
+	if size > uint64(len(c.buf)) {
+		return nil // Larger than the whole arena, the old value is dropped all the same
+	}
+	for c.used+size > uint64(len(c.buf)) {
+		c.reclaim()
+	}
+
+	hash := xxh3.Hash(key)
+	var h [arenaHeader]byte
+	binary.LittleEndian.PutUint64(h[0:], hash)
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(h[12:], uint32(len(value)))
+
+	off := c.head
+	c.head = c.write(c.head, h[:])
+	c.head = c.write(c.head, key)
+	c.head = c.write(c.head, value)
+	c.used += size
+	c.index[hash] = off
+	return nil
+}
+
+func (c *ArenaCache) Del(key []byte) {
+	c.mu.Lock()
+	if off, e, ok := c.lookup(key); ok {
+		c.setFlags(off, e.flags|flagDeleted)
+		delete(c.index, e.hash)
+	}
+	c.mu.Unlock()
+}
+
+// reclaim frees the entry at the tail of the ring, moving it to the head instead if it was read
+// since it was written. Caller must hold the lock and make sure the ring is not empty.
+func (c *ArenaCache) reclaim() {
+	off := c.tail
+	e := c.header(off)
+	size := e.size()
+	c.tail = c.at(c.tail, size)
+	c.used -= size
+
+	live := e.flags&flagDeleted == 0 && c.index[e.hash] == off
+	if !live {
+		return
+	}
+	if e.flags&flagAccessed == 0 {
+		delete(c.index, e.hash)
+		return
+	}
+
+	// Second chance, the bytes just freed at the tail are enough to move it to the head
+	if uint64(cap(c.scratch)) < size {
+		c.scratch = make([]byte, size)
+	}
+	entry := c.scratch[:size]
+	c.read(off, entry)
+	entry[arenaFlags] &^= flagAccessed
+	c.index[e.hash] = c.head
+	c.head = c.write(c.head, entry)
+	c.used += size
+}
+
+// ShardedArenaCache spreads keys over ArenaCache shards with the same shard selection as ShardedCache
+type ShardedArenaCache struct {
+	shards     []*ArenaCache
+	shardCount uint8
+}
+
+// NewShardedArenaCache creates shardCount arenas sharing totalMemory
+func NewShardedArenaCache(shardCount uint8, totalMemory int64) *ShardedArenaCache {
+	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
+		panic(fmt.Errorf("cxlrubytes shardCount must be a non-zero power of 2, got %d", shardCount))
+	}
+	shards := make([]*ArenaCache, shardCount)
+	for i := range shards {
+		shards[i] = NewArenaCache(totalMemory / int64(shardCount))
+	}
+	return &ShardedArenaCache{shards: shards, shardCount: shardCount}
+}
+
+func (sc *ShardedArenaCache) getShard(key []byte) *ArenaCache {
+	return sc.shards[uint8(xxh3.Hash(key))&(sc.shardCount-1)]
+}
+
+// Get returns a copy of the value from the appropriate shard, allocated on every hit
+func (sc *ShardedArenaCache) Get(key []byte) ([]byte, bool) {
+	return sc.getShard(key).Get(key)
+}
+
+// GetInto appends the value of key from the appropriate shard to dst, without allocating if dst has room
+func (sc *ShardedArenaCache) GetInto(key, dst []byte) ([]byte, bool) {
+	return sc.getShard(key).GetInto(key, dst)
+}
+
+// Set copies a key-value pair into the appropriate shard
+func (sc *ShardedArenaCache) Set(key, value []byte) {
+	sc.getShard(key).Set(key, value)
+}
+
+// Del removes a key from the appropriate shard
+func (sc *ShardedArenaCache) Del(key []byte) {
+	sc.getShard(key).Del(key)
+}
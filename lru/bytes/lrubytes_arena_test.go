@@ -0,0 +1,234 @@
+package lrubytes
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// checkArena walks the ring from tail to head and checks it against the index
+func checkArena(t *testing.T, c *ArenaCache) {
+	t.Helper()
+	var walked uint64
+	live := 0
+	for off := c.tail; walked < c.used; {
+		e := c.header(off)
+		if e.flags&flagDeleted == 0 && c.index[e.hash] == off {
+			live++
+		}
+		walked += e.size()
+		off = c.at(off, e.size())
+	}
+	if walked != c.used {
+		t.Fatalf("Ring walk covered %d bytes, used is %d", walked, c.used)
+	}
+	if c.used > 0 && c.at(c.tail, c.used) != c.head%uint64(len(c.buf)) {
+		t.Fatalf("Tail %d plus used %d does not reach head %d", c.tail, c.used, c.head)
+	}
+	if live != len(c.index) {
+		t.Fatalf("Found %d live entries in the ring, index has %d", live, len(c.index))
+	}
+}
+
+func TestArenaGetSetDel(t *testing.T) {
+	cache := NewArenaCache(1024)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("b"))
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be deleted")
+	}
+	if _, ok := cache.Get([]byte("missing")); ok {
+		t.Errorf("Expected a miss")
+	}
+	checkArena(t, cache)
+}
+
+func TestArenaCopiesKeysAndValues(t *testing.T) {
+	cache := NewArenaCache(1024)
+	key, value := []byte("key"), []byte("value")
+	cache.Set(key, value)
+	key[0], value[0] = 'X', 'X'
+
+	got, ok := cache.Get([]byte("key"))
+	if !ok || string(got) != "value" {
+		t.Fatalf("Expected the cache to keep its own copy, got %q, %v", got, ok)
+	}
+	got[0] = 'Y'
+	if again, _ := cache.Get([]byte("key")); string(again) != "value" {
+		t.Errorf("Expected Get to return a copy, got %q", again)
+	}
+}
+
+func TestArenaEvictsOldestUnread(t *testing.T) {
+	entrySize := arenaHeader + len("k0") + 8
+	cache := NewArenaCache(int64(4 * entrySize))
+	for i := 0; i < 4; i++ {
+		cache.Set([]byte(fmt.Sprintf("k%d", i)), make([]byte, 8))
+	}
+
+	// k0 was read so it gets a second chance, k1 is the oldest entry nobody read
+	cache.Get([]byte("k0"))
+	cache.Set([]byte("k4"), make([]byte, 8))
+
+	if _, ok := cache.Get([]byte("k1")); ok {
+		t.Errorf("Expected k1 to be evicted")
+	}
+	for _, key := range []string{"k0", "k2", "k3", "k4"} {
+		if _, ok := cache.Get([]byte(key)); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	checkArena(t, cache)
+}
+
+func TestArenaWrapsAround(t *testing.T) {
+	// An arena size that is not a multiple of the entry size makes entries straddle the end
+	cache := NewArenaCache(1000)
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		value := []byte(fmt.Sprintf("value%03d", i))
+		cache.Set(key, value)
+		if got, ok := cache.Get(key); !ok || string(got) != string(value) {
+			t.Fatalf("Expected %s -> %s, got %q, %v", key, value, got, ok)
+		}
+		checkArena(t, cache)
+	}
+}
+
+func TestArenaTooLarge(t *testing.T) {
+	cache := NewArenaCache(64)
+	cache.Set([]byte("a"), []byte("small"))
+	cache.Set([]byte("a"), make([]byte, 64))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected an entry larger than the arena to drop the old value")
+	}
+	checkArena(t, cache)
+}
+
+func TestArenaRandomOperations(t *testing.T) {
+	cache := NewArenaCache(4096)
+	model := make(map[string]string)
+	rng := rand.New(rand.NewSource(5))
+
+	for i := 0; i < 50000; i++ {
+		key := fmt.Sprintf("key%d", rng.Intn(300))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del([]byte(key))
+			delete(model, key)
+		case 1:
+			value := fmt.Sprintf("%d-%s", i, make([]byte, rng.Intn(48)))
+			cache.Set([]byte(key), []byte(value))
+			model[key] = value
+		default:
+			// Evicted entries may be missing, but a hit must be the latest value
+			if got, ok := cache.Get([]byte(key)); ok && string(got) != model[key] {
+				t.Fatalf("Expected %s -> %q, got %q", key, model[key], got)
+			}
+		}
+		if i%1000 == 0 {
+			checkArena(t, cache)
+		}
+	}
+	checkArena(t, cache)
+}
+
+func TestShardedArena(t *testing.T) {
+	// Large enough that no goroutine evicts what another one just set
+	cache := NewShardedArenaCache(8, 2*1024*1024)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := []byte(fmt.Sprintf("g%d-key%d", g, i))
+				cache.Set(key, key)
+				if got, ok := cache.Get(key); !ok || string(got) != string(key) {
+					t.Errorf("Expected %s to read back, got %q, %v", key, got, ok)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, shard := range cache.shards {
+		checkArena(t, shard)
+	}
+}
+
+func TestArenaGetIntoDoesNotAllocate(t *testing.T) {
+	cache := NewShardedArenaCache(4, 64*1024)
+	key, value := []byte("key1"), make([]byte, 100)
+	cache.Set(key, value)
+
+	buf := make([]byte, 0, 128)
+	if n := testing.AllocsPerRun(100, func() { buf, _ = cache.GetInto(key, buf[:0]) }); n != 0 {
+		t.Errorf("Expected GetInto with a reused buffer not to allocate, got %v allocs", n)
+	}
+	if len(buf) != len(value) {
+		t.Errorf("Expected %d bytes read, got %d", len(value), len(buf))
+	}
+	if n := testing.AllocsPerRun(100, func() { cache.Get(key) }); n == 0 {
+		t.Errorf("Expected Get to allocate the copy it returns, got %v allocs", n)
+	}
+}
+
+// The arena keeps GC work flat however many entries it holds, the LRU cache scans every slice
+func BenchmarkGCArenaVsLRU(b *testing.B) {
+	const entries = 200000
+	value := make([]byte, 64)
+	for _, bc := range []struct {
+		name string
+		set  func(key, value []byte) error
+	}{
+		{"Arena", NewArenaCache(entries * 128).Set},
+		{"LRU", NewLRUCache(entries*128, 1).Set},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < entries; i++ {
+				bc.set([]byte(fmt.Sprintf("key%d", i)), append([]byte(nil), value...))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+		})
+	}
+}
+
+func BenchmarkCXArenaBytesGet(b *testing.B) {
+	cache := NewArenaCache(1024 * 1024)
+	key, value := []byte("key"), make([]byte, 64)
+	cache.Set(key, value)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(key)
+	}
+}
+
+func BenchmarkCXArenaBytesSet(b *testing.B) {
+	cache := NewArenaCache(1024 * 1024)
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	value := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i&1023], value)
+	}
+}
@@ -0,0 +1,65 @@
+package lrubytes
+
+import (
+	"testing"
+	"time"
+)
+
+type evictRecord struct {
+	key, value string
+	reason     EvictReason
+}
+
+func TestOnEvictReasons(t *testing.T) {
+	var got []evictRecord
+	var cache *Cache
+	cache = NewLRUCache(3*(1+1+10), 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		// Calling back into the cache must not deadlock
+		cache.Get(key)
+		got = append(got, evictRecord{string(key), string(value), reason})
+	}))
+
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Set([]byte("d"), []byte("4")) // evicts a
+	cache.Set([]byte("b"), []byte("5")) // replaces b
+	cache.Del([]byte("c"))
+	cache.SetWithTTL([]byte("e"), []byte("6"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get([]byte("e"))
+
+	want := []evictRecord{
+		{"a", "1", EvictCapacity},
+		{"b", "2", EvictReplaced},
+		{"c", "3", EvictDeleted},
+		{"e", "6", EvictExpired},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d evictions, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Eviction %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestOnEvictSharded(t *testing.T) {
+	count := 0
+	cache := NewShardedCache(4, 4096, 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		if reason != EvictDeleted {
+			t.Errorf("Expected reason %v, got %v", EvictDeleted, reason)
+		}
+		count++
+	}))
+	for i := 0; i < 8; i++ {
+		cache.Set([]byte{byte(i)}, []byte("value"))
+	}
+	for i := 0; i < 8; i++ {
+		cache.Del([]byte{byte(i)})
+	}
+	if count != 8 {
+		t.Errorf("Expected 8 callbacks, got %d", count)
+	}
+}
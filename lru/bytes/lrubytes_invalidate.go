@@ -0,0 +1,58 @@
+package lrubytes
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// DelFunc removes every entry for which pred returns true and returns how many were removed
+// and the memory they freed. pred runs under the write lock, from the least recently used
+// entry up, and must not call back into the cache. WithOnEvict reports the removals as
+// EvictDeleted once the lock is released.
+func (c *Cache) DelFunc(pred func(key, value []byte) bool) (int, int64) {
+	c.mu.Lock()
+	before := atomic.LoadInt64(&c.currentMemory)
+	removed := 0
+	for segment := range c.lists {
+		for idx := c.lists[segment].tail; idx != InvalidIndex; {
+			entry := c.entries[idx]
+			prev := entry.prev
+			if pred(entry.key, entry.value) {
+				c.remove(idx, EvictDeleted)
+				removed++
+			}
+			idx = prev
+		}
+	}
+	freed := before - atomic.LoadInt64(&c.currentMemory)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return removed, freed
+}
+
+// DelPrefix removes every entry whose key starts with prefix, see DelFunc
+func (c *Cache) DelPrefix(prefix []byte) (int, int64) {
+	return c.DelFunc(func(key, _ []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+}
+
+// DelFunc removes the matching entries of every shard, locking one shard at a time, see Cache.DelFunc
+func (sc *ShardedCache) DelFunc(pred func(key, value []byte) bool) (int, int64) {
+	removed, freed := 0, int64(0)
+	for _, shard := range sc.shards {
+		n, size := shard.DelFunc(pred)
+		removed += n
+		freed += size
+	}
+	return removed, freed
+}
+
+// DelPrefix removes every entry whose key starts with prefix from every shard, see Cache.DelFunc
+func (sc *ShardedCache) DelPrefix(prefix []byte) (int, int64) {
+	return sc.DelFunc(func(key, _ []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+}
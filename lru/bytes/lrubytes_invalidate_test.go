@@ -0,0 +1,95 @@
+package lrubytes
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDelPrefix(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[string]EvictReason)
+	cache := NewLRUCache(4096, 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		mu.Lock()
+		reasons[string(key)] = reason
+		mu.Unlock()
+	}))
+	for i := 0; i < 5; i++ {
+		cache.Set([]byte(fmt.Sprintf("tenant:42:%d", i)), []byte("value"))
+		cache.Set([]byte(fmt.Sprintf("tenant:7:%d", i)), []byte("value"))
+	}
+	before := cache.Stats().Bytes
+
+	removed, freed := cache.DelPrefix([]byte("tenant:42:"))
+	if removed != 5 || freed != 5*cache.estimateMemory([]byte("tenant:42:0"), []byte("value")) {
+		t.Errorf("Expected 5 entries and their memory freed, got %d entries and %d bytes", removed, freed)
+	}
+	stats := cache.Stats()
+	if stats.Bytes != before-freed || stats.Items != 5 || stats.Deletes != 5 {
+		t.Errorf("Expected the memory and counters to follow the removals, got %+v", stats)
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := cache.Get([]byte(fmt.Sprintf("tenant:42:%d", i))); ok {
+			t.Errorf("Expected tenant:42:%d to be removed", i)
+		}
+		if _, ok := cache.Get([]byte(fmt.Sprintf("tenant:7:%d", i))); !ok {
+			t.Errorf("Expected tenant:7:%d to be kept", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != 5 {
+		t.Errorf("Expected 5 eviction callbacks, got %d", len(reasons))
+	}
+	for key, reason := range reasons {
+		if !strings.HasPrefix(key, "tenant:42:") || reason != EvictDeleted {
+			t.Errorf("Unexpected callback for %s: %s", key, reason)
+		}
+	}
+}
+
+func TestDelFuncSegments(t *testing.T) {
+	cache := NewLRUCache(4096, 1, WithSLRU(0.5))
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 10; i += 3 {
+		cache.Get([]byte(fmt.Sprintf("key%d", i))) // Promoted to the protected segment
+	}
+
+	removed, _ := cache.DelFunc(func(key, value []byte) bool {
+		return value[0]%2 == 0
+	})
+	if removed != 5 || cache.Len() != 5 {
+		t.Errorf("Expected the 5 even values removed from both segments, removed %d and %d left", removed, cache.Len())
+	}
+	for _, key := range cache.Keys() {
+		if value, _ := cache.Get(key); value[0]%2 == 0 {
+			t.Errorf("Expected %s to be removed", key)
+		}
+	}
+	if removed, freed := cache.DelPrefix([]byte("missing")); removed != 0 || freed != 0 {
+		t.Errorf("Expected nothing removed, got %d entries and %d bytes", removed, freed)
+	}
+}
+
+func TestShardedDelPrefix(t *testing.T) {
+	cache := NewShardedCache(8, 64*1024, 1)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("tenant:%d:%d", i%4, i)), []byte("value"))
+	}
+	before := cache.Stats().Bytes
+	removed, freed := cache.DelPrefix([]byte("tenant:1:"))
+	if removed != 25 || freed != before-cache.Stats().Bytes {
+		t.Errorf("Expected 25 entries removed, got %d entries and %d bytes", removed, freed)
+	}
+	if cache.Len() != 75 {
+		t.Errorf("Expected 75 entries left, got %d", cache.Len())
+	}
+	removed, _ = cache.DelFunc(func(key, value []byte) bool { return true })
+	if removed != 75 || cache.Stats().Bytes != 0 {
+		t.Errorf("Expected every entry removed and no memory left, got %d removed and %d bytes", removed, cache.Stats().Bytes)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package lrubytes
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set([]byte(key), []byte(key))
+	}
+
+	var forward, backward []string
+	for key, value := range cache.All() {
+		if string(key) != string(value) {
+			t.Errorf("Expected %s -> %s, got %s", key, key, value)
+		}
+		forward = append(forward, string(key))
+	}
+	for key := range cache.Backward() {
+		backward = append(backward, string(key))
+		if len(backward) == 2 {
+			break
+		}
+	}
+	if fmt.Sprint(forward) != "[c b a]" || fmt.Sprint(backward) != "[a b]" {
+		t.Errorf("Expected [c b a] and [a b], got %v and %v", forward, backward)
+	}
+
+	// The loop body runs without the lock, so it can delete what it visits
+	for key := range cache.All() {
+		cache.Del(key)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected Del inside the loop to empty the cache, %d left", cache.Len())
+	}
+
+	sharded := NewShardedCache(2, 1024, 1)
+	sharded.Set([]byte("x"), []byte("1"))
+	sharded.Set([]byte("y"), []byte("2"))
+	n := 0
+	for range sharded.All() {
+		n++
+	}
+	for range sharded.Backward() {
+		n++
+	}
+	if n != 4 {
+		t.Errorf("Expected both sharded iterators to visit 2 entries, got %d visits", n)
+	}
+}
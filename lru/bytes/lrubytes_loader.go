@@ -0,0 +1,158 @@
+package lrubytes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// LoaderFunc fetches the value of a key missing from the cache
+type LoaderFunc func(ctx context.Context, key []byte) ([]byte, error)
+
+// WithNegativeTTL makes GetOrLoad remember loader errors for ttl and return them without calling
+// the loader again until they expire. By default errors are not cached.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.loads.negativeTTL = ttl
+	}
+}
+
+// loadGroup collapses concurrent loads of the same key into a single loader call
+type loadGroup struct {
+	mu          sync.Mutex
+	calls       map[string]*loadCall
+	negatives   map[string]negative
+	negativeTTL time.Duration
+	pruneAt     int // Size of negatives at which expired errors are pruned
+}
+
+type loadCall struct {
+	done    chan struct{} // Closed once value and err are set
+	value   []byte
+	err     error
+	waiters int // Callers still waiting, the load is cancelled when the last one gives up
+	cancel  context.CancelFunc
+}
+
+type negative struct {
+	err      error
+	expireAt int64
+}
+
+// GetOrLoad returns the cached value of key, calling loader and caching its result on a miss.
+//
+// Concurrent misses on the same key share a single loader call. The loader runs on its own
+// goroutine with a context carrying the values of the first caller's, which is only cancelled
+// once every waiting caller has given up, a caller whose ctx is done returns ctx.Err() right
+// away. Loader errors are returned to every waiting caller and are not cached unless
+// WithNegativeTTL is set, a panicking loader is reported as an error.
+func (c *Cache) GetOrLoad(ctx context.Context, key []byte, loader LoaderFunc) ([]byte, error) {
+	return c.getOrLoad(ctx, key, loader, c.defaultTTL)
+}
+
+// getOrLoad is GetOrLoad storing loaded values with the given ttl
+func (c *Cache) getOrLoad(ctx context.Context, key []byte, loader LoaderFunc, ttl time.Duration) ([]byte, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	g := &c.loads
+	g.mu.Lock()
+	if n, ok := g.negatives[cx.B2s(key)]; ok {
+		if time.Now().UnixNano() < n.expireAt {
+			g.mu.Unlock()
+			return nil, n.err
+		}
+		delete(g.negatives, cx.B2s(key))
+	}
+
+	// A call every caller gave up on is being cancelled, so it is not joined
+	call, ok := g.calls[cx.B2s(key)]
+	if !ok || call.waiters == 0 {
+		keyStr := string(key) // The loader may outlive the caller's key
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &loadCall{done: make(chan struct{}), cancel: cancel}
+		if g.calls == nil {
+			g.calls = make(map[string]*loadCall)
+		}
+		g.calls[keyStr] = call
+		go c.load(loadCtx, keyStr, call, loader, ttl)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// load runs the loader for a call and publishes its result
+func (c *Cache) load(ctx context.Context, key string, call *loadCall, loader LoaderFunc, ttl time.Duration) {
+	call.value, call.err = callLoader(ctx, cx.S2b(key), loader)
+	if call.err == nil {
+		c.SetWithTTL(cx.S2b(key), call.value, ttl)
+	}
+
+	g := &c.loads
+	g.mu.Lock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	// Errors caused by every caller giving up say nothing about the key
+	if call.err != nil && g.negativeTTL > 0 && ctx.Err() == nil {
+		g.addNegative(key, call.err)
+	}
+	g.mu.Unlock()
+
+	call.cancel()
+	close(call.done)
+}
+
+func callLoader(ctx context.Context, key []byte, loader LoaderFunc) (value []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cxlrubytes: loader panic: %v", r)
+		}
+	}()
+	return loader(ctx, key)
+}
+
+// addNegative caches a loader error, caller must hold g.mu. Expired errors are pruned whenever
+// the map doubles so it stays proportional to the errors cached within one negativeTTL.
+func (g *loadGroup) addNegative(key string, err error) {
+	if g.negatives == nil {
+		g.negatives = make(map[string]negative)
+	}
+	now := time.Now().UnixNano()
+	if len(g.negatives) >= g.pruneAt {
+		for k, n := range g.negatives {
+			if now >= n.expireAt {
+				delete(g.negatives, k)
+			}
+		}
+		g.pruneAt = max(2*len(g.negatives), 64)
+	}
+	g.negatives[key] = negative{err: err, expireAt: now + int64(g.negativeTTL)}
+}
+
+// GetOrLoad returns the cached value of key or loads it, concurrent misses on the same key
+// share one loader call within its shard
+func (sc *ShardedCache) GetOrLoad(ctx context.Context, key []byte, loader LoaderFunc) ([]byte, error) {
+	shard := sc.getShard(key)
+	return shard.GetOrLoad(ctx, key, loader)
+}
@@ -0,0 +1,202 @@
+package lrubytes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadCollapsesConcurrentMisses(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("loaded:" + string(key)), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 50)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := cache.GetOrLoad(context.Background(), []byte("popular"), loader)
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			results[i] = value
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond) // Let every caller join the load
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 loader call, got %d", got)
+	}
+	for _, value := range results {
+		if string(value) != "loaded:popular" {
+			t.Fatalf("Expected every caller to get the loaded value, got %q", value)
+		}
+	}
+	if value, ok := cache.Get([]byte("popular")); !ok || string(value) != "loaded:popular" {
+		t.Errorf("Expected the loaded value to be cached, got %q, %v", value, ok)
+	}
+
+	if _, err := cache.GetOrLoad(context.Background(), []byte("popular"), loader); err != nil || calls.Load() != 1 {
+		t.Errorf("Expected a hit without calling the loader, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestGetOrLoadErrorsAreNotCached(t *testing.T) {
+	cache := NewLRUCache(4096, 1)
+	errDown := errors.New("backend down")
+	calls := 0
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		calls++
+		return nil, errDown
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetOrLoad(context.Background(), []byte("key"), loader); !errors.Is(err, errDown) {
+			t.Fatalf("Expected the loader error, got %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected every call to retry the loader, got %d calls", calls)
+	}
+	if _, ok := cache.Get([]byte("key")); ok {
+		t.Errorf("Expected nothing to be cached after an error")
+	}
+}
+
+func TestGetOrLoadNegativeTTL(t *testing.T) {
+	cache := NewLRUCache(4096, 1, WithNegativeTTL(20*time.Millisecond))
+	errMissing := errors.New("not found")
+	calls := 0
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		calls++
+		return nil, errMissing
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetOrLoad(context.Background(), []byte("key"), loader); !errors.Is(err, errMissing) {
+			t.Fatalf("Expected the loader error, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the error to be cached, got %d calls", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	cache.GetOrLoad(context.Background(), []byte("key"), loader)
+	if calls != 2 {
+		t.Errorf("Expected the loader to be retried once the error expired, got %d calls", calls)
+	}
+}
+
+func TestGetOrLoadCancellation(t *testing.T) {
+	cache := NewLRUCache(4096, 1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("value"), nil
+	}
+
+	// A caller giving up does not cancel the load for the others
+	ctx, cancel := context.WithCancel(context.Background())
+	impatient := make(chan error)
+	go func() {
+		_, err := cache.GetOrLoad(ctx, []byte("key"), loader)
+		impatient <- err
+	}()
+	<-started
+	patient := make(chan []byte)
+	go func() {
+		value, _ := cache.GetOrLoad(context.Background(), []byte("key"), loader)
+		patient <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-impatient; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+	close(release)
+	if value := <-patient; string(value) != "value" {
+		t.Errorf("Expected the remaining caller to get the value, got %q", value)
+	}
+}
+
+func TestGetOrLoadCancelsAbandonedLoad(t *testing.T) {
+	cache := NewLRUCache(4096, 1, WithNegativeTTL(time.Minute))
+	cancelled := make(chan struct{})
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cache.GetOrLoad(ctx, []byte("key"), loader); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the loader context to be cancelled once nobody waits")
+	}
+
+	// The cancellation is not cached as a negative result
+	value, err := cache.GetOrLoad(context.Background(), []byte("key"), func(ctx context.Context, key []byte) ([]byte, error) {
+		return []byte("value"), nil
+	})
+	if err != nil || string(value) != "value" {
+		t.Errorf("Expected a fresh load after the abandoned one, got %q, %v", value, err)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	cache := NewLRUCache(4096, 1)
+	_, err := cache.GetOrLoad(context.Background(), []byte("key"), func(ctx context.Context, key []byte) ([]byte, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Errorf("Expected a panicking loader to return an error")
+	}
+}
+
+func TestGetOrLoadPerKey(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1)
+	var calls atomic.Int32
+	loader := func(ctx context.Context, key []byte) ([]byte, error) {
+		calls.Add(1)
+		return append([]byte("v"), key...), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := []byte(fmt.Sprintf("key%d", i%10))
+			value, err := cache.GetOrLoad(context.Background(), key, loader)
+			if err != nil || string(value) != "v"+string(key) {
+				t.Errorf("Expected v%s, got %q, %v", key, value, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := calls.Load(); got < 10 {
+		t.Errorf("Expected at least one load per key, got %d", got)
+	}
+}
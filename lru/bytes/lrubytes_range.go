@@ -0,0 +1,119 @@
+package lrubytes
+
+import "time"
+
+// Range calls fn for every live entry from most to least recently used until fn returns false.
+// The entries are collected under the read lock and fn runs once it is released, so fn sees the
+// cache as it was when Range started and may call back into it, e.g. to Del the entries it
+// visits. The slices are the cache's own, like the ones Get returns.
+func (c *Cache) Range(fn func(key, value []byte) bool) {
+	c.walk(false, fn)
+}
+
+// RangeReverse is Range from least to most recently used, the order entries would be evicted in
+func (c *Cache) RangeReverse(fn func(key, value []byte) bool) {
+	c.walk(true, fn)
+}
+
+// walk calls fn for the entries collect returns, without holding the lock
+func (c *Cache) walk(reverse bool, fn func(key, value []byte) bool) {
+	for _, entry := range c.collect(reverse) {
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// collect copies out the live entries from the most to the least valuable segment, or the other
+// way round when reverse is set, skipping expired entries not swept yet
+func (c *Cache) collect(reverse bool) []entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]entry, 0, len(c.indexMap))
+	now := time.Now().UnixNano()
+	for i := range segmentOrder {
+		segment := segmentOrder[i]
+		idx := c.lists[segment].head
+		if reverse {
+			segment = segmentOrder[len(segmentOrder)-1-i]
+			idx = c.lists[segment].tail
+		}
+		for idx != InvalidIndex {
+			entry := c.entries[idx]
+			if entry.expireAt == 0 || now < entry.expireAt {
+				entries = append(entries, entry)
+			}
+			if reverse {
+				idx = entry.prev
+			} else {
+				idx = entry.next
+			}
+		}
+	}
+	return entries
+}
+
+// Keys returns copies of the live keys from most to least recently used
+func (c *Cache) Keys() [][]byte {
+	var keys [][]byte
+	c.Range(func(key, _ []byte) bool {
+		keys = append(keys, append([]byte(nil), key...))
+		return true
+	})
+	return keys
+}
+
+// Len returns the number of entries, including expired ones not swept yet
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.indexMap)
+}
+
+// Range calls fn for the entries of every shard in turn until fn returns false, each shard is
+// collected under its own read lock so the view is consistent per shard but not across shards
+func (sc *ShardedCache) Range(fn func(key, value []byte) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.Range(func(key, value []byte) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// RangeReverse is Range walking every shard from least to most recently used
+func (sc *ShardedCache) RangeReverse(fn func(key, value []byte) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.RangeReverse(func(key, value []byte) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns copies of the live keys of every shard, shard by shard
+func (sc *ShardedCache) Keys() [][]byte {
+	var keys [][]byte
+	for _, shard := range sc.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// Len returns the number of entries in every shard, locking one shard at a time
+func (sc *ShardedCache) Len() int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.Len()
+	}
+	return n
+}
@@ -0,0 +1,166 @@
+package lrubytes
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func rangeKeys(rangeFn func(func(key, value []byte) bool)) []string {
+	var keys []string
+	rangeFn(func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	return keys
+}
+
+func TestRangeOrder(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Set([]byte(key), []byte("value-"+key))
+	}
+	cache.Get([]byte("b"))
+
+	if got := fmt.Sprint(rangeKeys(cache.Range)); got != "[b d c a]" {
+		t.Errorf("Expected most to least recently used [b d c a], got %s", got)
+	}
+	if got := fmt.Sprint(rangeKeys(cache.RangeReverse)); got != "[a c d b]" {
+		t.Errorf("Expected least to most recently used [a c d b], got %s", got)
+	}
+
+	cache.Range(func(key, value []byte) bool {
+		if string(value) != "value-"+string(key) {
+			t.Errorf("Expected value-%s, got %s", key, value)
+		}
+		return true
+	})
+
+	visited := 0
+	cache.Range(func(key, value []byte) bool {
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Errorf("Expected Range to stop after 2 entries, visited %d", visited)
+	}
+}
+
+func TestRangeDeleteWhileWalking(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprint(i%2)))
+	}
+
+	// Selective invalidation from inside the walk must not deadlock on the cache lock
+	done := make(chan struct{})
+	go func() {
+		cache.Range(func(key, value []byte) bool {
+			if string(value) == "1" {
+				cache.Del(key)
+			}
+			return true
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Del inside Range not to block")
+	}
+	if cache.Len() != 5 {
+		t.Errorf("Expected the 5 odd entries deleted, %d left", cache.Len())
+	}
+
+	sharded := NewShardedCache(4, 4096, 1)
+	for i := 0; i < 20; i++ {
+		sharded.Set([]byte(fmt.Sprintf("key%d", i)), []byte("v"))
+	}
+	sharded.RangeReverse(func(key, _ []byte) bool {
+		sharded.Del(key)
+		return true
+	})
+	if sharded.Len() != 0 {
+		t.Errorf("Expected every entry deleted, %d left", sharded.Len())
+	}
+}
+
+func TestRangeSegments(t *testing.T) {
+	cache := NewLRUCache(1024, 1, WithSLRU(0.5))
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set([]byte(key), []byte(key))
+	}
+	cache.Get([]byte("a")) // Promoted to the protected segment
+
+	if got := fmt.Sprint(rangeKeys(cache.Range)); got != "[a c b]" {
+		t.Errorf("Expected protected before probation [a c b], got %s", got)
+	}
+	if got := fmt.Sprint(rangeKeys(cache.RangeReverse)); got != "[b c a]" {
+		t.Errorf("Expected eviction order [b c a], got %s", got)
+	}
+}
+
+func TestRangeSkipsExpired(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.Set([]byte("kept"), []byte("1"))
+	cache.SetWithTTL([]byte("expired"), []byte("2"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if got := fmt.Sprint(rangeKeys(cache.Range)); got != "[kept]" {
+		t.Errorf("Expected only [kept], got %s", got)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected Len to count the expired entry until it is swept, got %d", cache.Len())
+	}
+	cache.DeleteExpired()
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 entry after the sweep, got %d", cache.Len())
+	}
+}
+
+func TestKeysAreCopies(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.Set([]byte("key"), []byte("value"))
+	keys := cache.Keys()
+	if len(keys) != 1 || string(keys[0]) != "key" {
+		t.Fatalf("Expected [key], got %q", keys)
+	}
+	keys[0][0] = 'X'
+	if _, ok := cache.Get([]byte("key")); !ok {
+		t.Errorf("Expected modifying a returned key to leave the cache alone")
+	}
+}
+
+func TestShardedRange(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1)
+	var want []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cache.Set([]byte(key), []byte(key))
+		want = append(want, key)
+	}
+	sort.Strings(want)
+
+	for name, got := range map[string][]string{
+		"Range":        rangeKeys(cache.Range),
+		"RangeReverse": rangeKeys(cache.RangeReverse),
+	} {
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected %s to visit every key once, got %d keys", name, len(got))
+		}
+	}
+	if len(cache.Keys()) != 100 || cache.Len() != 100 {
+		t.Errorf("Expected 100 keys, got %d keys and Len %d", len(cache.Keys()), cache.Len())
+	}
+
+	visited := 0
+	cache.Range(func(key, value []byte) bool {
+		visited++
+		return visited < 30
+	})
+	if visited != 30 {
+		t.Errorf("Expected Range to stop across shards after 30 entries, visited %d", visited)
+	}
+}
@@ -0,0 +1,201 @@
+package lrubytes
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// refreshHeader is the soft deadline stored in front of every value, Unix nanoseconds, 0 means never
+const refreshHeader = 8
+
+// ErrRefreshValue is returned by RefreshingCache.Get for a value too short to hold the soft
+// deadline, i.e. one stored in the underlying cache without going through the wrapper
+var ErrRefreshValue = errors.New("cxlrubytes: value not stored by a RefreshingCache")
+
+// RefreshingCache serves stale values while they are reloaded in the background.
+//
+// Every entry has a soft and a hard expiry. Before its soft expiry Get returns the cached value,
+// after it Get still returns the cached value but queues one asynchronous reload on a bounded
+// pool of workers. Once the hard expiry has passed the entry is gone from the cache and Get
+// blocks on a reload, concurrent misses sharing one reload call like GetOrLoad.
+//
+// Values are stored with an 8 byte header holding the soft deadline, so the underlying cache
+// must only be accessed through the wrapper.
+type RefreshingCache struct {
+	cache   *ShardedCache
+	reload  LoaderFunc
+	softTTL time.Duration
+	hardTTL time.Duration
+	jobs    chan string // Keys to reload in the background
+	mu      sync.Mutex
+	pending map[string]struct{} // Keys queued or being reloaded in the background
+	closed  bool                // Set by Close under mu, no more reloads are queued once set
+	stats   refreshCounters
+	ctx     context.Context // Passed to background reloads, cancelled by Close
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// RefreshStats counts the background reloads of a RefreshingCache
+type RefreshStats struct {
+	Successes uint64 // Reloads that replaced the stale value
+	Failures  uint64 // Reloads whose error left the stale value in place
+	Dropped   uint64 // Reloads not queued because every worker was busy and the queue full
+}
+
+type refreshCounters struct {
+	successes atomic.Uint64
+	failures  atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewRefreshingCache wraps cache, reloading values with reload on workers goroutines. Entries
+// go soft stale after softTTL and are dropped after hardTTL, either being 0 means never. Up to
+// 16 reloads per worker can be queued, further stale hits are served without a reload.
+func NewRefreshingCache(cache *ShardedCache, reload LoaderFunc, softTTL, hardTTL time.Duration, workers int) *RefreshingCache {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &RefreshingCache{
+		cache:   cache,
+		reload:  reload,
+		softTTL: softTTL,
+		hardTTL: hardTTL,
+		jobs:    make(chan string, 16*workers),
+		pending: make(map[string]struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	r.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+// Get returns the value of key, serving it stale and reloading it in the background after its
+// soft expiry, and blocking on a reload when it is missing or past its hard expiry
+func (r *RefreshingCache) Get(ctx context.Context, key []byte) ([]byte, error) {
+	stored, ok := r.cache.Get(key)
+	if !ok || len(stored) < refreshHeader {
+		stored, err := r.cache.getShard(key).getOrLoad(ctx, key, r.load, r.hardTTL)
+		if err != nil {
+			return nil, err
+		}
+		if len(stored) < refreshHeader {
+			return nil, ErrRefreshValue
+		}
+		return stored[refreshHeader:], nil
+	}
+
+	if soft := int64(binary.BigEndian.Uint64(stored)); soft != 0 && time.Now().UnixNano() >= soft {
+		r.refresh(key)
+	}
+	return stored[refreshHeader:], nil
+}
+
+// Set stores value with the default soft and hard expiry
+func (r *RefreshingCache) Set(key, value []byte) {
+	r.SetWithExpiry(key, value, r.softTTL, r.hardTTL)
+}
+
+// SetWithExpiry stores value going stale after softTTL and dropped after hardTTL, either being 0
+// means never. Reloads of the entry use the default expiry again.
+func (r *RefreshingCache) SetWithExpiry(key, value []byte, softTTL, hardTTL time.Duration) {
+	r.cache.SetWithTTL(key, encodeRefresh(value, softTTL), hardTTL)
+}
+
+// Del removes key, a background reload already running may still store it again
+func (r *RefreshingCache) Del(key []byte) {
+	r.cache.Del(key)
+}
+
+// Stats returns the background reload counters
+func (r *RefreshingCache) Stats() RefreshStats {
+	return RefreshStats{
+		Successes: r.stats.successes.Load(),
+		Failures:  r.stats.failures.Load(),
+		Dropped:   r.stats.dropped.Load(),
+	}
+}
+
+// Close cancels the running reloads and stops the workers. Gets racing with or following Close
+// still serve cached values and block on reloads of missing ones, but queue no background reloads.
+func (r *RefreshingCache) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true // Sends happen under mu, so none can follow close below
+	r.mu.Unlock()
+
+	r.cancel()
+	close(r.jobs)
+	r.workers.Wait()
+}
+
+// refresh queues a background reload of key unless one is already pending
+func (r *RefreshingCache) refresh(key []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if _, ok := r.pending[cx.B2s(key)]; ok {
+		return
+	}
+
+	keyStr := string(key) // The reload outlives the caller's key
+	select {
+	case r.jobs <- keyStr:
+		r.pending[keyStr] = struct{}{}
+	default:
+		r.stats.dropped.Add(1)
+	}
+}
+
+func (r *RefreshingCache) work() {
+	defer r.workers.Done()
+	for keyStr := range r.jobs {
+		key := cx.S2b(keyStr)
+		value, err := callLoader(r.ctx, key, r.reload)
+		if err == nil {
+			r.Set(key, value)
+			r.stats.successes.Add(1)
+		} else {
+			r.stats.failures.Add(1)
+		}
+
+		r.mu.Lock()
+		delete(r.pending, keyStr)
+		r.mu.Unlock()
+	}
+}
+
+// load is the blocking reload, storing the default soft deadline with the value
+func (r *RefreshingCache) load(ctx context.Context, key []byte) ([]byte, error) {
+	value, err := r.reload(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRefresh(value, r.softTTL), nil
+}
+
+func encodeRefresh(value []byte, softTTL time.Duration) []byte {
+	var soft int64
+	if softTTL > 0 {
+		soft = time.Now().Add(softTTL).UnixNano()
+	}
+	stored := make([]byte, refreshHeader+len(value))
+	binary.BigEndian.PutUint64(stored, uint64(soft))
+	copy(stored[refreshHeader:], value)
+	return stored
+}
@@ -0,0 +1,198 @@
+package lrubytes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// versionedLoader returns an increasing version per call, failing while fail is set
+type versionedLoader struct {
+	calls atomic.Int32
+	fail  atomic.Bool
+	delay time.Duration
+}
+
+func (l *versionedLoader) load(ctx context.Context, key []byte) ([]byte, error) {
+	n := l.calls.Add(1)
+	time.Sleep(l.delay)
+	if l.fail.Load() {
+		return nil, errors.New("backend down")
+	}
+	return []byte{byte('0' + n)}, nil
+}
+
+// waitFor polls cond until it holds or a second passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefreshServesStaleWhileReloading(t *testing.T) {
+	loader := &versionedLoader{delay: 20 * time.Millisecond}
+	cache := NewRefreshingCache(NewShardedCache(4, 4096, 1), loader.load, 10*time.Millisecond, time.Hour, 2)
+	defer cache.Close()
+	ctx := context.Background()
+
+	// A miss blocks on the reload
+	if value, err := cache.Get(ctx, []byte("config")); err != nil || string(value) != "1" {
+		t.Fatalf("Expected the first load to return 1, got %q, %v", value, err)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	// Soft expired: every Get returns the stale value at once, only one reload is started
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		if value, err := cache.Get(ctx, []byte("config")); err != nil || string(value) != "1" {
+			t.Fatalf("Expected the stale value 1, got %q, %v", value, err)
+		}
+		if time.Since(start) > 10*time.Millisecond {
+			t.Fatalf("Expected a stale Get not to wait for the reload")
+		}
+	}
+
+	waitFor(t, "the background reload", func() bool { return cache.Stats().Successes == 1 })
+	if value, _ := cache.Get(ctx, []byte("config")); string(value) != "2" {
+		t.Errorf("Expected the refreshed value 2, got %q", value)
+	}
+	if got := loader.calls.Load(); got != 2 {
+		t.Errorf("Expected 2 loader calls, got %d", got)
+	}
+}
+
+func TestRefreshFailureKeepsStaleValue(t *testing.T) {
+	loader := &versionedLoader{}
+	cache := NewRefreshingCache(NewShardedCache(4, 4096, 1), loader.load, time.Millisecond, time.Hour, 1)
+	defer cache.Close()
+	ctx := context.Background()
+
+	cache.Get(ctx, []byte("config"))
+	loader.fail.Store(true)
+	time.Sleep(2 * time.Millisecond)
+
+	if value, err := cache.Get(ctx, []byte("config")); err != nil || string(value) != "1" {
+		t.Fatalf("Expected the stale value, got %q, %v", value, err)
+	}
+	waitFor(t, "the failed reload", func() bool { return cache.Stats().Failures == 1 })
+	if value, err := cache.Get(ctx, []byte("config")); err != nil || string(value) != "1" {
+		t.Errorf("Expected a failed reload to keep the stale value, got %q, %v", value, err)
+	}
+}
+
+func TestRefreshHardExpiryBlocks(t *testing.T) {
+	loader := &versionedLoader{}
+	cache := NewRefreshingCache(NewShardedCache(4, 4096, 1), loader.load, time.Millisecond, 5*time.Millisecond, 1)
+	defer cache.Close()
+	ctx := context.Background()
+
+	cache.Get(ctx, []byte("config"))
+	time.Sleep(10 * time.Millisecond)
+	if value, err := cache.Get(ctx, []byte("config")); err != nil || string(value) != "2" {
+		t.Errorf("Expected a hard expired entry to be reloaded before returning, got %q, %v", value, err)
+	}
+
+	loader.fail.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	if _, err := cache.Get(ctx, []byte("config")); err == nil {
+		t.Errorf("Expected the reload error once the entry is hard expired")
+	}
+}
+
+func TestRefreshPerEntryExpiry(t *testing.T) {
+	loader := &versionedLoader{}
+	cache := NewRefreshingCache(NewShardedCache(4, 4096, 1), loader.load, time.Millisecond, time.Hour, 1)
+	defer cache.Close()
+	ctx := context.Background()
+
+	cache.SetWithExpiry([]byte("pinned"), []byte("static"), 0, 0)
+	time.Sleep(5 * time.Millisecond)
+	if value, err := cache.Get(ctx, []byte("pinned")); err != nil || string(value) != "static" {
+		t.Errorf("Expected static, got %q, %v", value, err)
+	}
+	if loader.calls.Load() != 0 {
+		t.Errorf("Expected an entry without soft expiry never to be reloaded")
+	}
+}
+
+func TestRefreshCloseWhileGetting(t *testing.T) {
+	loader := &versionedLoader{}
+	cache := NewRefreshingCache(NewShardedCache(4, 64*1024, 1), loader.load, time.Nanosecond, time.Hour, 2)
+	for i := 0; i < 16; i++ {
+		cache.Set([]byte{byte(i)}, []byte("old"))
+	}
+
+	// Every Get hits a stale entry and tries to queue a reload while Close closes the queue
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := cache.Get(context.Background(), []byte{byte((g + i) % 16)}); err != nil {
+					t.Errorf("Unexpected error %v", err)
+					return
+				}
+			}
+		}(g)
+	}
+	time.Sleep(5 * time.Millisecond)
+	cache.Close()
+	cache.Close()
+	time.Sleep(5 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func TestRefreshRejectsShortValues(t *testing.T) {
+	sharded := NewShardedCache(4, 64*1024, 1)
+	cache := NewRefreshingCache(sharded, (&versionedLoader{}).load, time.Hour, time.Hour, 1)
+	defer cache.Close()
+
+	// Written around the wrapper, so there is no soft deadline in front of the value
+	sharded.Set([]byte("raw"), []byte("abc"))
+	if value, err := cache.Get(context.Background(), []byte("raw")); !errors.Is(err, ErrRefreshValue) {
+		t.Errorf("Expected ErrRefreshValue, got %q, %v", value, err)
+	}
+}
+
+func TestRefreshDropsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	cache := NewRefreshingCache(NewShardedCache(4, 64*1024, 1), func(ctx context.Context, key []byte) ([]byte, error) {
+		<-release
+		return []byte("v"), nil
+	}, time.Millisecond, time.Hour, 1)
+	defer func() {
+		once.Do(func() { close(release) })
+		cache.Close()
+	}()
+
+	for i := 0; i < 64; i++ {
+		cache.SetWithExpiry([]byte{byte(i)}, []byte("old"), time.Nanosecond, time.Hour)
+	}
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 64; i++ {
+		cache.Get(context.Background(), []byte{byte(i)})
+	}
+
+	// One reload runs, 16 are queued and the rest are dropped
+	if got := cache.Stats().Dropped; got < 64-17 {
+		t.Errorf("Expected at least %d dropped reloads, got %d", 64-17, got)
+	}
+	once.Do(func() { close(release) })
+}
@@ -0,0 +1,35 @@
+package lrubytes
+
+// WithCopyOnSet makes Set and SetWithTTL store copies of the key and value, so callers may reuse
+// their buffers once Set returns. Without it the cache keeps the caller's slices and changing
+// them afterwards silently changes the cached entry. Get still returns the cached slice, use
+// GetInto to read a copy that is safe to modify.
+func WithCopyOnSet() Option {
+	return func(c *Cache) {
+		c.copyOnSet = true
+	}
+}
+
+// clone copies key and value into a single allocation
+func clone(key, value []byte) ([]byte, []byte) {
+	buf := make([]byte, len(key)+len(value))
+	copy(buf, key)
+	copy(buf[len(key):], value)
+	return buf[:len(key):len(key)], buf[len(key):]
+}
+
+// GetInto appends the value of key to dst and returns the extended slice. Unlike the slice
+// returned by Get the result does not share memory with the cache, so modifying it is safe and
+// reusing dst across calls reads without allocating.
+func (c *Cache) GetInto(key, dst []byte) ([]byte, bool) {
+	value, ok := c.Get(key)
+	if !ok {
+		return dst, false
+	}
+	return append(dst, value...), true
+}
+
+// GetInto appends the value of key from the appropriate shard to dst
+func (sc *ShardedCache) GetInto(key, dst []byte) ([]byte, bool) {
+	return sc.getShard(key).GetInto(key, dst)
+}
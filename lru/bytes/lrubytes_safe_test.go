@@ -0,0 +1,124 @@
+package lrubytes
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The default mode keeps the caller's slices, these tests pin down the aliasing that implies
+
+func TestAliasingReusedSetBuffer(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	buf := []byte("first")
+	cache.Set([]byte("a"), buf)
+	copy(buf, "XXXXX")
+
+	if value, _ := cache.Get([]byte("a")); string(value) != "XXXXX" {
+		t.Fatalf("Expected reusing the Set buffer to change the cached value, got %q", value)
+	}
+
+	safe := NewLRUCache(1024, 1, WithCopyOnSet())
+	buf = []byte("first")
+	safe.Set([]byte("a"), buf)
+	copy(buf, "XXXXX")
+	if value, _ := safe.Get([]byte("a")); string(value) != "first" {
+		t.Errorf("Expected WithCopyOnSet to keep its own copy, got %q", value)
+	}
+}
+
+func TestAliasingReusedKeyBuffer(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	key := []byte("key1")
+	cache.Set(key, []byte("v"))
+	copy(key, "key2")
+
+	// The index now holds a key that no longer matches the bytes it was stored under
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Fatalf("Expected reusing the key buffer to lose key1")
+	}
+
+	safe := NewLRUCache(1024, 1, WithCopyOnSet())
+	key = []byte("key1")
+	safe.Set(key, []byte("v"))
+	copy(key, "key2")
+	if _, ok := safe.Get([]byte("key1")); !ok {
+		t.Errorf("Expected WithCopyOnSet to find key1 after the caller reused its buffer")
+	}
+	if _, ok := safe.Get([]byte("key2")); ok {
+		t.Errorf("Expected no key2")
+	}
+	checkInvariants(t, safe)
+}
+
+func TestAliasingMutatedGetResult(t *testing.T) {
+	cache := NewLRUCache(1024, 1, WithCopyOnSet())
+	cache.Set([]byte("a"), []byte("value"))
+
+	value, _ := cache.Get([]byte("a"))
+	value[0] = 'X'
+	if again, _ := cache.Get([]byte("a")); string(again) != "Xalue" {
+		t.Fatalf("Expected Get to return the cached slice, got %q", again)
+	}
+
+	cache.Set([]byte("a"), []byte("value"))
+	value, ok := cache.GetInto([]byte("a"), nil)
+	if !ok || string(value) != "value" {
+		t.Fatalf("Expected value, got %q, %v", value, ok)
+	}
+	value[0] = 'X'
+	if again, _ := cache.Get([]byte("a")); string(again) != "value" {
+		t.Errorf("Expected modifying the GetInto result to leave the cache alone, got %q", again)
+	}
+}
+
+func TestGetIntoAppends(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1, WithCopyOnSet())
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	dst, ok := cache.GetInto([]byte("a"), []byte("prefix:"))
+	if !ok || string(dst) != "prefix:1" {
+		t.Errorf("Expected prefix:1, got %q, %v", dst, ok)
+	}
+	dst, ok = cache.GetInto([]byte("missing"), dst[:0])
+	if ok || len(dst) != 0 {
+		t.Errorf("Expected a miss to return dst unchanged, got %q, %v", dst, ok)
+	}
+	if dst, ok = cache.GetInto([]byte("b"), dst); !ok || string(dst) != "2" {
+		t.Errorf("Expected 2, got %q, %v", dst, ok)
+	}
+}
+
+func TestCopyOnSetMemoryAccounting(t *testing.T) {
+	cache := NewLRUCache(1024, 1, WithCopyOnSet())
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i%10)), make([]byte, i))
+	}
+	checkInvariants(t, cache)
+}
+
+func TestArenaGetInto(t *testing.T) {
+	cache := NewShardedArenaCache(4, 4096)
+	cache.Set([]byte("a"), []byte("value"))
+
+	buf := make([]byte, 0, 64)
+	dst, ok := cache.GetInto([]byte("a"), buf)
+	if !ok || string(dst) != "value" || &dst[0] != &buf[:1][0] {
+		t.Errorf("Expected value read into the caller's buffer, got %q, %v", dst, ok)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { cache.GetInto([]byte("a"), buf) }); allocs != 0 {
+		t.Errorf("Expected GetInto with enough room not to allocate, got %v allocations", allocs)
+	}
+}
+
+func BenchmarkCXLRUBytesGetInto(b *testing.B) {
+	cache := NewLRUCache(1024*1024, 1, WithCopyOnSet())
+	key := []byte("key")
+	cache.Set(key, make([]byte, 64))
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = cache.GetInto(key, buf[:0])
+	}
+}
@@ -0,0 +1,422 @@
+package lrubytes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// Segment record layout: crc32c of the rest (4) | key len (4) | value len (4) | kind (1) | key | value
+const (
+	recordHeader = 13
+
+	recordValue     = 0
+	recordTombstone = 1 // The key was deleted, hides its older records during recovery
+
+	segmentExt = ".seg"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// segment is one append only file of the store
+type segment struct {
+	id   uint64
+	file *os.File
+	size int64 // Bytes written
+	live int64 // Bytes of the records the index still points at
+}
+
+// recordLoc is where the latest value of a key lives on disk
+type recordLoc struct {
+	segment *segment
+	off     int64
+	size    int64
+}
+
+// segmentStore is a log structured key value store on disk with a byte budget. Records are
+// appended to the newest segment, the oldest segment is compacted once it is mostly garbage and
+// dropped with whatever it still holds when the store is over its budget. It is not safe for
+// concurrent use, TieredCache serializes the calls.
+type segmentStore struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+	segments    []*segment // Oldest first, the last one is appended to
+	index       map[string]recordLoc
+	total       int64
+	buf         []byte
+}
+
+// openSegmentStore opens the store in dir, creating it if needed. Existing segments are scanned
+// oldest first with later records winning, a segment is truncated at its first torn or corrupt
+// record, which is where a crash interrupted the last write. Intact records too large for a
+// budget lowered since they were written are skipped, and mostly garbage segments compacted
+// before the budget drops the oldest ones, so the records around them are kept.
+func openSegmentStore(dir string, maxBytes int64) (*segmentStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &segmentStore{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: max(maxBytes/8, 1),
+		index:       make(map[string]recordLoc),
+	}
+
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.recover(id); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	var next uint64
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	if err := s.addSegment(next); err != nil {
+		s.close()
+		return nil, err
+	}
+	for len(s.segments) > 1 && s.segments[0].live*2 <= s.segments[0].size {
+		if err := s.compactOldest(); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	s.enforceBudget()
+	return s, nil
+}
+
+// segmentIDs lists the segments in dir from oldest to newest
+func (s *segmentStore) segmentIDs() ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(names))
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			continue // Not one of ours
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *segmentStore) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+func (s *segmentStore) addSegment(id uint64) error {
+	file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &segment{id: id, file: file})
+	return nil
+}
+
+func (s *segmentStore) active() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// recover indexes the records of an existing segment
+func (s *segmentStore) recover(id uint64) error {
+	file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	seg := &segment{id: id, file: file}
+	s.segments = append(s.segments, seg)
+
+	valid, err := s.scan(seg, func(off int64, kind byte, key, value []byte) {
+		size := int64(recordHeader + len(key) + len(value))
+		if old, ok := s.index[cx.B2s(key)]; ok {
+			old.segment.live -= old.size
+			if kind == recordTombstone {
+				delete(s.index, cx.B2s(key))
+			}
+		}
+		if kind == recordValue {
+			s.index[string(key)] = recordLoc{segment: seg, off: off, size: size}
+			seg.live += size
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// Drop the torn tail so new records are not appended after garbage
+	if err := file.Truncate(valid); err != nil {
+		return err
+	}
+	seg.size = valid
+	s.total += valid
+	return nil
+}
+
+// scan calls fn with every intact record of seg in order and returns where the intact records end.
+// The slices passed to fn are only valid during the call.
+func (s *segmentStore) scan(seg *segment, fn func(off int64, kind byte, key, value []byte)) (int64, error) {
+	info, err := seg.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(seg.file, 0, 1<<62))
+	var off int64
+	var header [recordHeader]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return off, nil
+			}
+			return off, err
+		}
+		keyLen := binary.LittleEndian.Uint32(header[4:])
+		valueLen := binary.LittleEndian.Uint32(header[8:])
+		kind := header[12]
+		size := int64(keyLen) + int64(valueLen)
+		if kind > recordTombstone || off+recordHeader+size > info.Size() {
+			return off, nil // Garbage where a header should be, or a record cut short
+		}
+		if size > s.maxBytes {
+			intact, err := s.skipOversized(r, header, fn, off)
+			if err != nil || !intact {
+				return off, err
+			}
+			off += recordHeader + size
+			continue
+		}
+		body := s.buffer(int(keyLen) + int(valueLen))
+		if _, err := io.ReadFull(r, body); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return off, nil
+			}
+			return off, err
+		}
+		crc := crc32.Update(crc32.Checksum(header[4:], crcTable), crcTable, body)
+		if crc != binary.LittleEndian.Uint32(header[0:]) {
+			return off, nil
+		}
+		fn(off, kind, body[:keyLen], body[keyLen:])
+		off += int64(recordHeader + len(body))
+	}
+}
+
+// skipOversized reads through a record written under a larger budget, checking it without
+// holding its value in memory. An intact one is passed to fn as a tombstone with its key, if
+// that fits in memory, since its value can no longer be stored and older ones must stay hidden.
+func (s *segmentStore) skipOversized(r io.Reader, header [recordHeader]byte, fn func(off int64, kind byte, key, value []byte), off int64) (bool, error) {
+	keyLen := int64(binary.LittleEndian.Uint32(header[4:]))
+	valueLen := int64(binary.LittleEndian.Uint32(header[8:]))
+	crc := crc32.New(crcTable)
+	crc.Write(header[4:])
+
+	var key []byte
+	if keyLen <= s.maxBytes {
+		key = s.buffer(int(keyLen))
+		if _, err := io.ReadFull(r, key); err != nil {
+			return false, torn(err)
+		}
+		crc.Write(key)
+	} else {
+		valueLen += keyLen // No smaller record can have had this key
+	}
+	if _, err := io.CopyN(crc, r, valueLen); err != nil {
+		return false, torn(err)
+	}
+	if crc.Sum32() != binary.LittleEndian.Uint32(header[0:]) {
+		return false, nil
+	}
+	if key != nil {
+		fn(off, recordTombstone, key, nil)
+	}
+	return true, nil
+}
+
+// torn reports a record cut short by the end of the file as no error, the scan just ends there
+func torn(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// buffer returns a scratch slice of n bytes, reused between calls
+func (s *segmentStore) buffer(n int) []byte {
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	return s.buf[:n]
+}
+
+// append writes a record to the active segment and returns its location
+func (s *segmentStore) append(kind byte, key, value []byte) (recordLoc, error) {
+	seg := s.active()
+	record := s.buffer(recordHeader + len(key) + len(value))
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(value)))
+	record[12] = kind
+	copy(record[recordHeader:], key)
+	copy(record[recordHeader+len(key):], value)
+	binary.LittleEndian.PutUint32(record[0:], crc32.Checksum(record[4:], crcTable))
+
+	if _, err := seg.file.WriteAt(record, seg.size); err != nil {
+		return recordLoc{}, err
+	}
+	loc := recordLoc{segment: seg, off: seg.size, size: int64(len(record))}
+	seg.size += loc.size
+	s.total += loc.size
+	return loc, nil
+}
+
+// unlink drops key from the index, caller must know it is indexed
+func (s *segmentStore) unlink(key []byte) {
+	loc := s.index[cx.B2s(key)]
+	loc.segment.live -= loc.size
+	delete(s.index, cx.B2s(key))
+}
+
+func (s *segmentStore) has(key []byte) bool {
+	_, ok := s.index[cx.B2s(key)]
+	return ok
+}
+
+// get reads the value of key, a record failing its checksum is dropped and reported as missing
+func (s *segmentStore) get(key []byte) ([]byte, bool, error) {
+	loc, ok := s.index[cx.B2s(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	record := make([]byte, loc.size)
+	if _, err := loc.segment.file.ReadAt(record, loc.off); err != nil {
+		return nil, false, err
+	}
+	if crc32.Checksum(record[4:], crcTable) != binary.LittleEndian.Uint32(record[0:]) {
+		s.unlink(key)
+		return nil, false, nil
+	}
+	return record[recordHeader+len(key):], true, nil
+}
+
+func (s *segmentStore) put(key, value []byte) error {
+	if int64(recordHeader+len(key)+len(value)) > s.maxBytes {
+		return s.del(key) // Larger than the whole store
+	}
+	loc, err := s.append(recordValue, key, value)
+	if err != nil {
+		return err
+	}
+	if s.has(key) {
+		s.unlink(key)
+	}
+	s.index[string(key)] = loc
+	loc.segment.live += loc.size
+	return s.maintain()
+}
+
+// del writes a tombstone so the older records of key stay hidden after a restart
+func (s *segmentStore) del(key []byte) error {
+	if !s.has(key) {
+		return nil
+	}
+	s.unlink(key)
+	if _, err := s.append(recordTombstone, key, nil); err != nil {
+		return err
+	}
+	return s.maintain()
+}
+
+// maintain rolls the active segment once it is full, compacts the oldest segment while it is
+// mostly garbage and drops the oldest segments while the store is over its budget
+func (s *segmentStore) maintain() error {
+	if s.active().size < s.segmentSize {
+		return nil
+	}
+	if err := s.addSegment(s.active().id + 1); err != nil {
+		return err
+	}
+	for len(s.segments) > 1 && s.segments[0].live*2 <= s.segments[0].size {
+		if err := s.compactOldest(); err != nil {
+			return err
+		}
+	}
+	s.enforceBudget()
+	return nil
+}
+
+// compactOldest moves the live records of the oldest segment to the active one and removes it.
+// Its tombstones go too, there is no older segment left for them to hide anything in.
+func (s *segmentStore) compactOldest() error {
+	oldest := s.segments[0]
+	type moved struct {
+		key, value []byte
+	}
+	var live []moved
+	if _, err := s.scan(oldest, func(off int64, kind byte, key, value []byte) {
+		if loc, ok := s.index[cx.B2s(key)]; ok && loc.segment == oldest && loc.off == off {
+			live = append(live, moved{key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+		}
+	}); err != nil {
+		return err
+	}
+	for _, m := range live {
+		loc, err := s.append(recordValue, m.key, m.value)
+		if err != nil {
+			return err
+		}
+		s.index[string(m.key)] = loc
+		loc.segment.live += loc.size
+	}
+	s.removeOldest()
+	return nil
+}
+
+// enforceBudget drops the oldest segments and the entries left in them while over the budget
+func (s *segmentStore) enforceBudget() {
+	for s.total > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if oldest.live > 0 {
+			for key, loc := range s.index {
+				if loc.segment == oldest {
+					delete(s.index, key)
+				}
+			}
+		}
+		s.removeOldest()
+	}
+}
+
+func (s *segmentStore) removeOldest() {
+	oldest := s.segments[0]
+	s.segments = s.segments[1:]
+	s.total -= oldest.size
+	oldest.file.Close()
+	os.Remove(oldest.file.Name())
+}
+
+// close syncs and closes every segment
+func (s *segmentStore) close() error {
+	var err error
+	for _, seg := range s.segments {
+		err = errors.Join(err, seg.file.Sync(), seg.file.Close())
+	}
+	s.segments = nil
+	return err
+}
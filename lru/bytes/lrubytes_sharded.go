@@ -2,6 +2,7 @@ package lrubytes
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/zeebo/xxh3"
 )
@@ -12,15 +13,16 @@ type ShardedCache struct {
 	shardCount uint8
 }
 
-// NewShardedCache creates a new ShardedCache with the specified number of shards, total memory limit, and eviction count
-func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int) *ShardedCache {
+// NewShardedCache creates a new ShardedCache with the specified number of shards, total memory limit, and eviction count,
+// the options are applied to every shard
+func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int, opts ...Option) *ShardedCache {
 	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
 		panic(fmt.Errorf("cxlrubytes shardCount must be a non-zero multiple of 2, got %d", shardCount))
 	}
 	maxMemoryPerShard := totalMemory / int64(shardCount) // Calculate memory per shard
 	shards := make([]*Cache, shardCount)
 	for i := uint8(0); i < shardCount; i++ {
-		shards[i] = NewLRUCache(maxMemoryPerShard, evictionCount) // Now passes evictionCount to each shard
+		shards[i] = NewLRUCache(maxMemoryPerShard, evictionCount, opts...) // Now passes evictionCount to each shard
 	}
 	return &ShardedCache{
 		shards:     shards,
@@ -30,8 +32,13 @@ func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int) *Sh
 
 // getShard comSetes the hash of the key to determine which shard to use
 func (sc *ShardedCache) getShard(key []byte) *Cache {
+	return sc.shards[sc.shardIndex(key)]
+}
+
+// shardIndex returns the position of the shard owning key
+func (sc *ShardedCache) shardIndex(key []byte) uint8 {
 	hash := xxh3.Hash(key)
-	return sc.shards[uint8(hash)&(sc.shardCount-1)]
+	return uint8(hash) & (sc.shardCount - 1)
 }
 
 // Get retrieves a value from the appropriate shard
@@ -46,8 +53,38 @@ func (sc *ShardedCache) Set(key, value []byte) {
 	shard.Set(key, value)
 }
 
+// SetWithTTL adds a key-value pair expiring after ttl to the appropriate shard
+func (sc *ShardedCache) SetWithTTL(key, value []byte, ttl time.Duration) {
+	shard := sc.getShard(key)
+	shard.SetWithTTL(key, value, ttl)
+}
+
 // Delete removes a key from the appropriate shard
 func (sc *ShardedCache) Del(key []byte) {
 	shard := sc.getShard(key)
 	shard.Del(key)
 }
+
+// DeleteExpired removes expired entries from every shard, locking one shard at a time
+func (sc *ShardedCache) DeleteExpired() int {
+	removed := 0
+	for _, shard := range sc.shards {
+		removed += shard.DeleteExpired()
+	}
+	return removed
+}
+
+// StartSweeper runs a background sweeper per shard every interval, so a shard that is slow to
+// sweep or held locked does not delay the expiry of the others
+func (sc *ShardedCache) StartSweeper(interval time.Duration) {
+	for _, shard := range sc.shards {
+		shard.StartSweeper(interval)
+	}
+}
+
+// StopSweeper stops the background sweepers, it is a no-op if none is running
+func (sc *ShardedCache) StopSweeper() {
+	for _, shard := range sc.shards {
+		shard.StopSweeper()
+	}
+}
@@ -0,0 +1,19 @@
+package lrubytes
+
+import "fmt"
+
+// WithSLRU splits the cache into a probation and a protected segment (segmented LRU). New entries
+// start in probation and are promoted to the protected segment on their next hit, protected
+// entries overflowing protectedFraction of the memory are demoted back to probation, and
+// probation is always evicted first. One-off scans then only flush probation, which is much
+// cheaper than the frequency tracking of WithTinyLFU since hits keep the read lock fast path.
+//
+// Passed after WithTinyLFU it sets the protected share of the main segment instead.
+func WithSLRU(protectedFraction float64) Option {
+	if protectedFraction <= 0 || protectedFraction >= 1 {
+		panic(fmt.Errorf("cxlrubytes protectedFraction must be between 0 and 1, got %v", protectedFraction))
+	}
+	return func(c *Cache) {
+		c.protectedMax = max(int64(float64(c.maxMemory-c.windowMax)*protectedFraction), 1)
+	}
+}
@@ -0,0 +1,86 @@
+package lrubytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSLRUBeatsLRUOnScans(t *testing.T) {
+	trace := scanTrace(100000)
+	entrySize := int64(len("scan00000") + 32 + 10)
+
+	lru := NewLRUCache(150*entrySize, 1)
+	slru := NewLRUCache(150*entrySize, 1, WithSLRU(0.8))
+
+	lruRatio := hitRatio(lru, trace)
+	slruRatio := hitRatio(slru, trace)
+	t.Logf("LRU hit ratio %.3f, SLRU hit ratio %.3f", lruRatio, slruRatio)
+
+	if slruRatio <= lruRatio+0.1 {
+		t.Errorf("Expected SLRU (%.3f) to clearly beat LRU (%.3f) on a scan heavy trace", slruRatio, lruRatio)
+	}
+	checkInvariants(t, slru)
+}
+
+func TestSLRUMatchesLRUWithoutScans(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	trace := make([][]byte, 50000)
+	for i := range trace {
+		trace[i] = []byte(fmt.Sprintf("key%d", rng.Intn(100)))
+	}
+	entrySize := int64(len("key00") + 32 + 10)
+
+	// With room for the whole working set neither policy should miss after warming up
+	lruRatio := hitRatio(NewLRUCache(120*entrySize, 1), trace)
+	slruRatio := hitRatio(NewLRUCache(120*entrySize, 1, WithSLRU(0.8)), trace)
+	if slruRatio < lruRatio-0.001 {
+		t.Errorf("Expected SLRU (%.4f) to hit as often as LRU (%.4f) when everything fits", slruRatio, lruRatio)
+	}
+}
+
+func TestSLRUPromotesOnSecondHit(t *testing.T) {
+	cache := NewLRUCache(1024, 1, WithSLRU(0.5))
+	cache.Set([]byte("a"), []byte("1"))
+	if segment := cache.entries[cache.indexMap["a"]].segment; segment != segmentProbation {
+		t.Fatalf("Expected a new entry in probation, got segment %d", segment)
+	}
+
+	cache.Get([]byte("a"))
+	if segment := cache.entries[cache.indexMap["a"]].segment; segment != segmentProtected {
+		t.Fatalf("Expected a hit to promote the entry, got segment %d", segment)
+	}
+
+	// Overflowing the protected segment demotes its least recently used entries
+	for i := 0; i < 40; i++ {
+		key := []byte(fmt.Sprintf("key%02d", i))
+		cache.Set(key, make([]byte, 8))
+		cache.Get(key)
+	}
+	if got := cache.lists[segmentProtected].memory; got > cache.protectedMax {
+		t.Errorf("Expected the protected segment within %d bytes, got %d", cache.protectedMax, got)
+	}
+	if segment := cache.entries[cache.indexMap["a"]].segment; segment == segmentProtected {
+		t.Errorf("Expected a to be demoted out of the protected segment")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSLRUSharded(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1, WithSLRU(0.8))
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < 20000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(2000)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
@@ -0,0 +1,343 @@
+package lrubytes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// Snapshot layout, all integers are varints unless noted:
+//
+//	magic "CXLB" | version byte
+//	per entry, head to tail: 0x01 | key len | value len | expireAt | key | value
+//	0x00 | entry count | CRC-32C of everything before it (4 bytes, big endian)
+const (
+	snapshotMagic   = "CXLB"
+	snapshotVersion = 1
+
+	recordEntry = 0x01
+	recordEnd   = 0x00
+)
+
+var (
+	ErrSnapshotFormat   = errors.New("cxlrubytes: not a cache snapshot")
+	ErrSnapshotVersion  = errors.New("cxlrubytes: unsupported snapshot version")
+	ErrSnapshotChecksum = errors.New("cxlrubytes: snapshot checksum mismatch")
+)
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotWriter struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	out   io.Writer
+	buf   [binary.MaxVarintLen64]byte
+	count uint64
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.New(snapshotTable)}
+	sw.out = io.MultiWriter(sw.w, sw.crc)
+	return sw
+}
+
+func (sw *snapshotWriter) writeHeader() error {
+	_, err := sw.out.Write(append([]byte(snapshotMagic), snapshotVersion))
+	return err
+}
+
+func (sw *snapshotWriter) writeUvarint(v uint64) error {
+	_, err := sw.out.Write(sw.buf[:binary.PutUvarint(sw.buf[:], v)])
+	return err
+}
+
+func (sw *snapshotWriter) writeEntry(e *entry) error {
+	if _, err := sw.out.Write([]byte{recordEntry}); err != nil {
+		return err
+	}
+	if err := sw.writeUvarint(uint64(len(e.key))); err != nil {
+		return err
+	}
+	if err := sw.writeUvarint(uint64(len(e.value))); err != nil {
+		return err
+	}
+	if _, err := sw.out.Write(sw.buf[:binary.PutVarint(sw.buf[:], e.expireAt)]); err != nil {
+		return err
+	}
+	if _, err := sw.out.Write(e.key); err != nil {
+		return err
+	}
+	if _, err := sw.out.Write(e.value); err != nil {
+		return err
+	}
+	sw.count++
+	return nil
+}
+
+func (sw *snapshotWriter) writeTrailer() error {
+	if _, err := sw.out.Write([]byte{recordEnd}); err != nil {
+		return err
+	}
+	if err := sw.writeUvarint(sw.count); err != nil {
+		return err
+	}
+	if err := binary.Write(sw.w, binary.BigEndian, sw.crc.Sum32()); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// writeEntries streams the cache from head to tail under the read lock, segment by segment
+func (c *Cache) writeEntries(sw *snapshotWriter) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, segment := range segmentOrder {
+		for idx := c.lists[segment].head; idx != InvalidIndex; {
+			entry := c.entries[idx]
+			if err := sw.writeEntry(&entry); err != nil {
+				return err
+			}
+			idx = entry.next
+		}
+	}
+	return nil
+}
+
+// Save writes every entry from most to least recently used so Load can rebuild the same order.
+// The read lock is held while the snapshot is written, so Sets, Dels and the Gets that need the
+// write lock wait until Save returns: hits not at the head of their segment, and every Get
+// with WithTinyLFU. Only hits at the head of their segment and misses go on meanwhile.
+func (c *Cache) Save(w io.Writer) error {
+	sw := newSnapshotWriter(w)
+	if err := sw.writeHeader(); err != nil {
+		return err
+	}
+	if err := c.writeEntries(sw); err != nil {
+		return err
+	}
+	return sw.writeTrailer()
+}
+
+// Save writes every shard in turn, each shard is consistent on its own
+func (sc *ShardedCache) Save(w io.Writer) error {
+	sw := newSnapshotWriter(w)
+	if err := sw.writeHeader(); err != nil {
+		return err
+	}
+	for _, shard := range sc.shards {
+		if err := shard.writeEntries(sw); err != nil {
+			return err
+		}
+	}
+	return sw.writeTrailer()
+}
+
+type snapshotEntry struct {
+	key, value []byte
+	expireAt   int64
+}
+
+// hashingReader feeds everything read through it into the checksum
+type hashingReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.crc.Write(p[:n])
+	return n, err
+}
+
+func (hr *hashingReader) ReadByte() (byte, error) {
+	b, err := hr.r.ReadByte()
+	if err == nil {
+		hr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// readSnapshot decodes and verifies a whole snapshot. Entries larger than maxEntry, expired ones
+// and every entry after the first that would take the key and value bytes kept past budget are
+// read through for the checksum without being allocated, since they could never be stored
+func readSnapshot(r io.Reader, maxEntry, budget int64) ([]snapshotEntry, error) {
+	hr := &hashingReader{r: bufio.NewReader(r), crc: crc32.New(snapshotTable)}
+
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(hr, header); err != nil {
+		return nil, ErrSnapshotFormat
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotFormat
+	}
+	if header[len(snapshotMagic)] != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, header[len(snapshotMagic)])
+	}
+
+	var entries []snapshotEntry
+	var count, kept uint64
+	full := false
+	now := time.Now().UnixNano()
+	for {
+		kind, err := hr.ReadByte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if kind == recordEnd {
+			break
+		}
+		if kind != recordEntry {
+			return nil, ErrSnapshotFormat
+		}
+
+		keyLen, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		valueLen, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		expireAt, err := binary.ReadVarint(hr)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		count++
+
+		size := keyLen + valueLen
+		tooLarge := keyLen > uint64(maxEntry) || valueLen > uint64(maxEntry) || size > uint64(maxEntry)
+		if !tooLarge && !full && kept+size > uint64(budget) {
+			full = true // Load stops at the first entry that does not fit, nothing after it is kept
+		}
+		if tooLarge || full || (expireAt != 0 && now >= expireAt) {
+			if _, err := io.CopyN(io.Discard, hr, int64(keyLen)); err != nil {
+				return nil, unexpected(err)
+			}
+			if _, err := io.CopyN(io.Discard, hr, int64(valueLen)); err != nil {
+				return nil, unexpected(err)
+			}
+			continue
+		}
+
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(hr, buf); err != nil {
+			return nil, unexpected(err)
+		}
+		kept += size
+		entries = append(entries, snapshotEntry{key: buf[:keyLen:keyLen], value: buf[keyLen:], expireAt: expireAt})
+	}
+
+	written, err := binary.ReadUvarint(hr)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	sum := hr.crc.Sum32()
+
+	var stored uint32
+	if err := binary.Read(hr.r, binary.BigEndian, &stored); err != nil {
+		return nil, unexpected(err)
+	}
+	if stored != sum || written != count {
+		return nil, ErrSnapshotChecksum
+	}
+	return entries, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// pushBack appends an entry at the least recently used end, caller must hold the write lock.
+// It reports false once the cache is full, keys already cached are left untouched.
+// With a segmented policy entries go to probation, W-TinyLFU keeps its window free.
+func (c *Cache) pushBack(key, value []byte, expireAt int64) bool {
+	keyStr := cx.B2s(key)
+	if _, ok := c.indexMap[keyStr]; ok {
+		return true
+	}
+
+	memSize := c.estimateMemory(key, value)
+	if atomic.LoadInt64(&c.currentMemory)+memSize > c.maxMemory-c.windowMax {
+		return false
+	}
+
+	segment := uint8(segmentLRU)
+	if c.protectedMax > 0 {
+		segment = segmentProbation
+	}
+
+	c.wrapIndexCounter()
+	idx := c.indexCounter
+	c.entries[idx] = entry{key: key, value: value, prev: InvalidIndex, next: InvalidIndex, expireAt: expireAt}
+	c.indexMap[keyStr] = idx
+	c.linkBack(idx, segment)
+	c.indexCounter++
+
+	c.adjustMemory(memSize)
+	return true
+}
+
+// Load restores a snapshot written by Save. Entries keep their saved order behind anything
+// already cached, expired entries are skipped, and once the memory limit is reached the
+// remaining least recently used entries are dropped. Nothing is loaded if the snapshot is
+// corrupt.
+func (c *Cache) Load(r io.Reader) error {
+	entries, err := readSnapshot(r, c.maxMemory, c.maxMemory)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range entries {
+		if !c.pushBack(e.key, e.value, e.expireAt) {
+			break
+		}
+	}
+	return nil
+}
+
+// Load restores a snapshot written by either Save into the shards the keys hash to,
+// so it also works when the shard count changed
+func (sc *ShardedCache) Load(r io.Reader) error {
+	maxEntry, total := int64(0), int64(0)
+	for _, shard := range sc.shards {
+		maxEntry = max(maxEntry, shard.maxMemory)
+		total += shard.maxMemory
+	}
+	entries, err := readSnapshot(r, maxEntry, total)
+	if err != nil {
+		return err
+	}
+
+	// Route first so every shard is locked once
+	routed := make([][]snapshotEntry, len(sc.shards))
+	for _, e := range entries {
+		i := sc.shardIndex(e.key)
+		routed[i] = append(routed[i], e)
+	}
+
+	for i, shard := range sc.shards {
+		shard.mu.Lock()
+		for _, e := range routed[i] {
+			if !shard.pushBack(e.key, e.value, e.expireAt) {
+				break
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return nil
+}
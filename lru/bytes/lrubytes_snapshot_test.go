@@ -0,0 +1,197 @@
+package lrubytes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// order lists the keys from head to tail, segment by segment
+func order(c *Cache) []string {
+	var keys []string
+	for _, segment := range segmentOrder {
+		for idx := c.lists[segment].head; idx != InvalidIndex; idx = c.entries[idx].next {
+			keys = append(keys, string(c.entries[idx].key))
+		}
+	}
+	return keys
+}
+
+func TestSaveLoadPreservesOrder(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for i := 0; i < 5; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	cache.Get([]byte("key1"))
+	cache.SetWithTTL([]byte("ttl"), []byte("value"), time.Hour)
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewLRUCache(1024, 1)
+	if err := restored.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fmt.Sprint(order(restored)), fmt.Sprint(order(cache)); got != want {
+		t.Errorf("Expected order %s, got %s", want, got)
+	}
+	if restored.currentMemory != cache.currentMemory {
+		t.Errorf("Expected currentMemory %d, got %d", cache.currentMemory, restored.currentMemory)
+	}
+	if value, ok := restored.Get([]byte("key3")); !ok || string(value) != "value3" {
+		t.Errorf("Expected key3 -> value3, got %q, %v", value, ok)
+	}
+	ttlIdx := restored.indexMap["ttl"]
+	if restored.entries[ttlIdx].expireAt != cache.entries[cache.indexMap["ttl"]].expireAt {
+		t.Errorf("Expected the TTL to survive the snapshot")
+	}
+}
+
+func TestLoadRespectsSmallerLimit(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte{byte('a' + i)}, []byte("value"))
+	}
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	entrySize := cache.estimateMemory([]byte("a"), []byte("value"))
+	restored := NewLRUCache(3*entrySize, 1)
+	if err := restored.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The three most recently used survive
+	if got, want := fmt.Sprint(order(restored)), "[j i h]"; got != want {
+		t.Errorf("Expected order %s, got %s", want, got)
+	}
+	if restored.currentMemory != 3*entrySize {
+		t.Errorf("Expected currentMemory %d, got %d", 3*entrySize, restored.currentMemory)
+	}
+}
+
+func TestLoadKeepsOnlyWhatFits(t *testing.T) {
+	cache := NewLRUCache(1<<20, 1)
+	for i := 0; i < 500; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%03d", i)), make([]byte, 1000))
+	}
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Only the entries that fit in 10KB are decoded, the rest is only checksummed
+	entries, err := readSnapshot(bytes.NewReader(data), 10*1024, 10*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 || string(entries[0].key) != "key499" {
+		t.Errorf("Expected the 10 most recently used entries, got %d starting at %q", len(entries), entries[0].key)
+	}
+
+	// Corruption past the budget still fails the checksum
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-100] ^= 0xff
+	if _, err := readSnapshot(bytes.NewReader(corrupt), 10*1024, 10*1024); !errors.Is(err, ErrSnapshotChecksum) {
+		t.Errorf("Expected ErrSnapshotChecksum, got %v", err)
+	}
+
+	restored := NewLRUCache(10*1024, 1)
+	if err := restored.Load(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() == 0 || restored.Stats().Bytes > 10*1024 {
+		t.Errorf("Expected the cache filled up to its limit, got %d entries and %d bytes", restored.Len(), restored.Stats().Bytes)
+	}
+}
+
+func TestLoadSkipsExpired(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.SetWithTTL([]byte("a"), []byte("1"), time.Millisecond)
+	cache.Set([]byte("b"), []byte("2"))
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	restored := NewLRUCache(1024, 1)
+	if err := restored.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(order(restored)), "[b]"; got != want {
+		t.Errorf("Expected order %s, got %s", want, got)
+	}
+}
+
+func TestLoadRejectsCorruption(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-8] ^= 0xff
+	if err := NewLRUCache(1024, 1).Load(bytes.NewReader(flipped)); err == nil {
+		t.Errorf("Expected an error for a flipped byte")
+	}
+
+	restored := NewLRUCache(1024, 1)
+	if err := restored.Load(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Errorf("Expected an error for a truncated snapshot")
+	}
+	if len(restored.indexMap) != 0 {
+		t.Errorf("Expected nothing to be loaded from a truncated snapshot")
+	}
+
+	if err := restored.Load(bytes.NewReader([]byte("nope"))); !errors.Is(err, ErrSnapshotFormat) {
+		t.Errorf("Expected ErrSnapshotFormat, got %v", err)
+	}
+
+	versioned := append([]byte(nil), data...)
+	versioned[len(snapshotMagic)] = 99
+	if err := restored.Load(bytes.NewReader(versioned)); !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("Expected ErrSnapshotVersion, got %v", err)
+	}
+}
+
+func TestShardedSaveLoadAcrossShardCounts(t *testing.T) {
+	cache := NewShardedCache(8, 64*1024, 1)
+	for i := 0; i < 200; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewShardedCache(4, 64*1024, 1)
+	if err := restored.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		value, ok := restored.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	if got, want := restored.Stats().Bytes, cache.Stats().Bytes; got != want {
+		t.Errorf("Expected %d bytes after restore, got %d", want, got)
+	}
+}
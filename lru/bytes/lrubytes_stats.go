@@ -0,0 +1,103 @@
+package lrubytes
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a point in time view of a cache's counters and memory usage
+type Stats struct {
+	Hits        uint64 // Get calls that found a live entry
+	Misses      uint64 // Get calls that found nothing or an expired entry
+	Sets        uint64 // Entries stored by Set or SetWithTTL
+	Deletes     uint64 // Entries removed by Del
+	Evictions   uint64 // Entries dropped to make room for new ones
+	Expirations uint64 // Entries removed because their TTL passed
+	Rejected    uint64 // Sets dropped because the entry alone exceeds the memory limit
+	Bytes       int64  // Estimated memory currently in use
+	MaxBytes    int64  // Memory limit
+	Items       int    // Number of entries currently stored
+}
+
+// HitRatio returns hits / (hits + misses), or 0 before the first Get
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// add accumulates other into s, used to aggregate shards
+func (s *Stats) add(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Sets += other.Sets
+	s.Deletes += other.Deletes
+	s.Evictions += other.Evictions
+	s.Expirations += other.Expirations
+	s.Rejected += other.Rejected
+	s.Bytes += other.Bytes
+	s.MaxBytes += other.MaxBytes
+	s.Items += other.Items
+}
+
+// counters are updated with atomics so the read locked Get path does not need the write lock
+type counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	deletes     atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	rejected    atomic.Uint64
+}
+
+// record counts a removal, replacements are not counted since the Set that caused them is
+func (c *counters) record(reason EvictReason) {
+	switch reason {
+	case EvictCapacity:
+		c.evictions.Add(1)
+	case EvictDeleted:
+		c.deletes.Add(1)
+	case EvictExpired:
+		c.expirations.Add(1)
+	}
+}
+
+// Stats returns the cache's counters and current memory usage
+func (c *Cache) Stats() Stats {
+	c.mu.RLock()
+	items := len(c.indexMap)
+	c.mu.RUnlock()
+
+	return Stats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Sets:        c.stats.sets.Load(),
+		Deletes:     c.stats.deletes.Load(),
+		Evictions:   c.stats.evictions.Load(),
+		Expirations: c.stats.expirations.Load(),
+		Rejected:    c.stats.rejected.Load(),
+		Bytes:       atomic.LoadInt64(&c.currentMemory),
+		MaxBytes:    c.maxMemory,
+		Items:       items,
+	}
+}
+
+// Stats returns the counters of all shards added together
+func (sc *ShardedCache) Stats() Stats {
+	var total Stats
+	for _, shard := range sc.shards {
+		total.add(shard.Stats())
+	}
+	return total
+}
+
+// ShardStats returns the counters of every shard, indexed by shard number
+func (sc *ShardedCache) ShardStats() []Stats {
+	stats := make([]Stats, len(sc.shards))
+	for i, shard := range sc.shards {
+		stats[i] = shard.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,73 @@
+package lrubytes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	entrySize := int64(1 + 5 + 10)
+	cache := NewLRUCache(2*entrySize, 1)
+
+	cache.Set([]byte("a"), []byte("value"))
+	cache.Set([]byte("b"), []byte("value"))
+	cache.Set([]byte("c"), []byte("value")) // evicts a
+	cache.Get([]byte("a"))
+	cache.Get([]byte("b"))
+	cache.Get([]byte("c"))
+	cache.Del([]byte("b"))
+	cache.Del([]byte("b"))
+	cache.Set([]byte("huge"), make([]byte, 100))
+	cache.SetWithTTL([]byte("d"), []byte("value"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get([]byte("d"))
+
+	want := Stats{
+		Hits:        2,
+		Misses:      2,
+		Sets:        4,
+		Deletes:     1,
+		Evictions:   1,
+		Expirations: 1,
+		Rejected:    1,
+		Bytes:       entrySize,
+		MaxBytes:    2 * entrySize,
+		Items:       1,
+	}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Expected stats %+v, got %+v", want, got)
+	}
+	if ratio := cache.Stats().HitRatio(); ratio != 0.5 {
+		t.Errorf("Expected hit ratio 0.5, got %v", ratio)
+	}
+}
+
+func TestShardedStats(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1)
+	for i := 0; i < 32; i++ {
+		cache.Set([]byte{byte(i)}, []byte("value"))
+	}
+	for i := 0; i < 64; i++ {
+		cache.Get([]byte{byte(i)})
+	}
+
+	total := cache.Stats()
+	if total.Hits != 32 || total.Misses != 32 || total.Sets != 32 || total.Items != 32 {
+		t.Errorf("Unexpected aggregated stats %+v", total)
+	}
+	if total.MaxBytes != 4096 {
+		t.Errorf("Expected MaxBytes 4096, got %d", total.MaxBytes)
+	}
+
+	shards := cache.ShardStats()
+	if len(shards) != 4 {
+		t.Fatalf("Expected 4 shard stats, got %d", len(shards))
+	}
+	var sum Stats
+	for _, s := range shards {
+		sum.add(s)
+	}
+	if sum != total {
+		t.Errorf("Expected shard stats to add up to %+v, got %+v", total, sum)
+	}
+}
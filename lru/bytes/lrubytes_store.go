@@ -0,0 +1,251 @@
+package lrubytes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// ErrNotFound is returned by a Store that does not hold the key
+var ErrNotFound = errors.New("cxlrubytes: key not found")
+
+// Store is the backing store a StoreCache reads misses from and writes changes to
+type Store interface {
+	Get(ctx context.Context, key []byte) ([]byte, error) // ErrNotFound when the key is missing
+	Put(ctx context.Context, key, value []byte) error
+	Delete(ctx context.Context, key []byte) error
+}
+
+// StoreCache is a Cache in front of a Store. Misses are read from the store, Set either writes
+// through to the store before caching or, in write-back mode, only marks the entry dirty and
+// writes it with the next flush. Dirty entries are never lost to eviction: they stay readable in
+// the write-back buffer until flushed, and evicting flushBatch of them starts a flush in the
+// background, so the Set or load that caused the eviction never waits on the store.
+type StoreCache struct {
+	cache      *Cache
+	store      Store
+	writeBack  bool
+	flushBatch int
+	mu         sync.Mutex
+	dirty      map[string][]byte // Written but not yet flushed
+	flushing   map[string][]byte // Taken by the running flush, still readable
+	evicted    int               // Dirty entries no longer in the cache since the last flush
+	flushErr   error             // Failures of flushes nobody waited for
+	flushMu    sync.Mutex        // Serializes flushes
+	flusher    sweeper
+	queued     atomic.Bool    // An eviction triggered flush is scheduled or running
+	flushes    sync.WaitGroup // Eviction triggered flushes, waited for by Close
+}
+
+// NewWriteThroughCache creates a cache in front of store, Set and Del reach the store before returning
+func NewWriteThroughCache(store Store, maxMemory int64, evictBatchSize int, opts ...Option) *StoreCache {
+	sc := &StoreCache{store: store}
+	sc.cache = NewLRUCache(maxMemory, evictBatchSize, opts...)
+	return sc
+}
+
+// NewWriteBackCache creates a cache in front of store that buffers Sets and writes them on Flush,
+// on the interval of StartFlusher, or once flushBatch dirty entries were evicted from the cache
+func NewWriteBackCache(store Store, maxMemory int64, evictBatchSize int, flushBatch int, opts ...Option) *StoreCache {
+	sc := &StoreCache{
+		store:      store,
+		writeBack:  true,
+		flushBatch: max(flushBatch, 1),
+		dirty:      make(map[string][]byte),
+	}
+	sc.cache = NewLRUCache(maxMemory, evictBatchSize, append(opts, sc.trackEvictions)...)
+	return sc
+}
+
+// trackEvictions chains onto any EvictFunc from the caller's options
+func (sc *StoreCache) trackEvictions(c *Cache) {
+	next := c.onEvict
+	c.onEvict = func(key, value []byte, reason EvictReason) {
+		if reason == EvictCapacity || reason == EvictExpired {
+			sc.evictedDirty(key)
+		}
+		if next != nil {
+			next(key, value, reason)
+		}
+	}
+}
+
+// evictedDirty counts a dirty entry leaving the cache, starting a flush once flushBatch are only buffered
+func (sc *StoreCache) evictedDirty(key []byte) {
+	sc.mu.Lock()
+	if _, ok := sc.dirty[cx.B2s(key)]; !ok {
+		sc.mu.Unlock()
+		return
+	}
+	sc.evicted++
+	full := sc.evicted >= sc.flushBatch
+	sc.mu.Unlock()
+
+	if full {
+		sc.queueFlush()
+	}
+}
+
+// queueFlush runs a flush on its own goroutine unless one is already scheduled or running, it
+// keeps flushing while enough dirty entries were evicted meanwhile to fill another batch
+func (sc *StoreCache) queueFlush() {
+	if !sc.queued.CompareAndSwap(false, true) {
+		return
+	}
+	sc.flushes.Add(1)
+	go func() {
+		defer sc.flushes.Done()
+		for {
+			sc.backgroundFlush()
+			sc.queued.Store(false)
+
+			sc.mu.Lock()
+			full := sc.evicted >= sc.flushBatch
+			sc.mu.Unlock()
+			if !full || !sc.queued.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}()
+}
+
+// Get returns the value of key, reading it from the store on a miss
+func (sc *StoreCache) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return sc.cache.GetOrLoad(ctx, key, sc.load)
+}
+
+func (sc *StoreCache) load(ctx context.Context, key []byte) ([]byte, error) {
+	if sc.writeBack {
+		sc.mu.Lock()
+		value, ok := sc.dirty[cx.B2s(key)]
+		if !ok {
+			value, ok = sc.flushing[cx.B2s(key)]
+		}
+		sc.mu.Unlock()
+		if ok {
+			return value, nil
+		}
+	}
+	return sc.store.Get(ctx, key)
+}
+
+// Set caches value under key. In write-through mode it is written to the store first and nothing
+// is cached if that fails, in write-back mode it is buffered until the next flush.
+func (sc *StoreCache) Set(ctx context.Context, key, value []byte) error {
+	if !sc.writeBack {
+		if err := sc.store.Put(ctx, key, value); err != nil {
+			return err
+		}
+		sc.cache.Set(key, value)
+		return nil
+	}
+
+	sc.mu.Lock()
+	sc.dirty[string(key)] = value
+	sc.mu.Unlock()
+	sc.cache.Set(key, value)
+	return nil
+}
+
+// Del removes key from the cache, the write-back buffer and the store. In write-back mode it
+// waits for a running flush so the flush cannot write the key back after it was deleted.
+func (sc *StoreCache) Del(ctx context.Context, key []byte) error {
+	if sc.writeBack {
+		sc.flushMu.Lock()
+		defer sc.flushMu.Unlock()
+		sc.mu.Lock()
+		delete(sc.dirty, cx.B2s(key))
+		sc.mu.Unlock()
+	}
+	// The store goes first so a concurrent miss cannot load the old value back into the cache
+	err := sc.store.Delete(ctx, key)
+	sc.cache.Del(key)
+	return err
+}
+
+// Flush writes every dirty entry to the store. Entries that failed stay dirty for the next flush,
+// the returned error also includes failures of flushes triggered by eviction or StartFlusher
+// since the last Flush.
+func (sc *StoreCache) Flush(ctx context.Context) error {
+	err := sc.flush(ctx)
+
+	sc.mu.Lock()
+	err = errors.Join(sc.flushErr, err)
+	sc.flushErr = nil
+	sc.mu.Unlock()
+	return err
+}
+
+func (sc *StoreCache) backgroundFlush() {
+	if err := sc.flush(context.Background()); err != nil {
+		sc.mu.Lock()
+		sc.flushErr = errors.Join(sc.flushErr, err)
+		sc.mu.Unlock()
+	}
+}
+
+func (sc *StoreCache) flush(ctx context.Context) error {
+	if !sc.writeBack {
+		return nil
+	}
+	sc.flushMu.Lock()
+	defer sc.flushMu.Unlock()
+
+	// The batch stays readable by Get and is not modified until the flush is over
+	sc.mu.Lock()
+	batch := sc.dirty
+	sc.flushing = batch
+	sc.dirty = make(map[string][]byte)
+	sc.evicted = 0
+	keys := make([]string, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	sc.mu.Unlock()
+
+	var err error
+	written := 0
+	for _, key := range keys {
+		if err = sc.store.Put(ctx, cx.S2b(key), batch[key]); err != nil {
+			break
+		}
+		written++
+	}
+
+	// Whatever was not written goes back, unless it was set again meanwhile
+	sc.mu.Lock()
+	for _, key := range keys[written:] {
+		if _, ok := sc.dirty[key]; !ok {
+			sc.dirty[key] = batch[key]
+		}
+	}
+	sc.flushing = nil
+	sc.mu.Unlock()
+	return err
+}
+
+// StartFlusher flushes the write-back buffer every interval in the background until StopFlusher is called
+func (sc *StoreCache) StartFlusher(interval time.Duration) {
+	sc.flusher.start(interval, sc.backgroundFlush)
+}
+
+// StopFlusher stops the background flusher, it is a no-op if none is running
+func (sc *StoreCache) StopFlusher() {
+	sc.flusher.stop()
+}
+
+// Close stops the background flusher, waits for flushes started by eviction and flushes the write-back buffer
+func (sc *StoreCache) Close(ctx context.Context) error {
+	sc.StopFlusher()
+	sc.flushes.Wait()
+	return sc.Flush(ctx)
+}
+
+// Cache returns the underlying cache, for Stats and the like. Writing to it bypasses the store.
+func (sc *StoreCache) Cache() *Cache {
+	return sc.cache
+}
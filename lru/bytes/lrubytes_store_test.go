@@ -0,0 +1,316 @@
+package lrubytes
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store counting the calls it gets
+type memStore struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	gets     int
+	puts     int
+	failPuts bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte)}
+}
+
+func (s *memStore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *memStore) Put(ctx context.Context, key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failPuts {
+		return errors.New("disk full")
+	}
+	s.puts++
+	s.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *memStore) Delete(ctx context.Context, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+func (s *memStore) get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data[key]
+	return value, ok
+}
+
+func (s *memStore) putCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.puts
+}
+
+// slowStore is a memStore whose Puts wait until release is closed
+type slowStore struct {
+	*memStore
+	started chan struct{} // Closed by the first Put
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *slowStore) Put(ctx context.Context, key, value []byte) error {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	return s.memStore.Put(ctx, key, value)
+}
+
+// fileStore keeps every key in its own file under dir
+type fileStore struct {
+	dir string
+}
+
+func (s fileStore) path(key []byte) string {
+	return filepath.Join(s.dir, hex.EncodeToString(key))
+}
+
+func (s fileStore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	value, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s fileStore) Put(ctx context.Context, key, value []byte) error {
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, value, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(key))
+}
+
+func (s fileStore) Delete(ctx context.Context, key []byte) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func TestWriteThrough(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	cache := NewWriteThroughCache(store, 4096, 1)
+
+	if err := cache.Set(ctx, []byte("a"), []byte("1")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if value, ok := store.get("a"); !ok || string(value) != "1" {
+		t.Errorf("Expected Set to reach the store, got %q, %v", value, ok)
+	}
+	if value, err := cache.Get(ctx, []byte("a")); err != nil || string(value) != "1" || store.gets != 0 {
+		t.Errorf("Expected a cache hit, got %q, %v after %d store reads", value, err, store.gets)
+	}
+
+	store.data["b"] = []byte("2")
+	if value, err := cache.Get(ctx, []byte("b")); err != nil || string(value) != "2" {
+		t.Errorf("Expected a miss to read the store, got %q, %v", value, err)
+	}
+	if _, err := cache.Get(ctx, []byte("missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	store.failPuts = true
+	if err := cache.Set(ctx, []byte("c"), []byte("3")); err == nil {
+		t.Errorf("Expected the store error")
+	}
+	if _, ok := cache.Cache().Get([]byte("c")); ok {
+		t.Errorf("Expected nothing to be cached when the store write failed")
+	}
+
+	cache.Del(ctx, []byte("a"))
+	if _, ok := store.get("a"); ok {
+		t.Errorf("Expected Del to reach the store")
+	}
+}
+
+func TestWriteBackFlush(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	cache := NewWriteBackCache(store, 4096, 1, 16)
+
+	for i := 0; i < 10; i++ {
+		cache.Set(ctx, []byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if store.puts != 0 {
+		t.Fatalf("Expected write-back to buffer Sets, got %d store writes", store.puts)
+	}
+	if value, err := cache.Get(ctx, []byte("key3")); err != nil || string(value) != "value3" {
+		t.Errorf("Expected a dirty entry to be readable, got %q, %v", value, err)
+	}
+
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatalf("Unexpected flush error %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if value, ok := store.get(fmt.Sprintf("key%d", i)); !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Errorf("Expected key%d to be flushed, got %q, %v", i, value, ok)
+		}
+	}
+	if err := cache.Flush(ctx); err != nil || store.puts != 10 {
+		t.Errorf("Expected a second flush to have nothing to write, got %v after %d writes", err, store.puts)
+	}
+}
+
+func TestWriteBackNeverDropsDirtyEntries(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	entrySize := int64(len("key000") + len("value000") + 10)
+	cache := NewWriteBackCache(store, 10*entrySize, 1, 50)
+
+	// Far more entries than the cache holds, most of them evicted while dirty
+	for i := 0; i < 200; i++ {
+		cache.Set(ctx, []byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%03d", i)))
+	}
+	deadline := time.Now().Add(time.Second)
+	for store.putCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected evicting dirty entries to start a flush")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Entries evicted but not flushed yet are still readable
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		if value, err := cache.Get(ctx, []byte(key)); err != nil || string(value) != fmt.Sprintf("value%03d", i) {
+			t.Fatalf("Expected %s to be readable, got %q, %v", key, value, err)
+		}
+	}
+
+	if err := cache.Close(ctx); err != nil {
+		t.Fatalf("Unexpected close error %v", err)
+	}
+	if len(store.data) != 200 {
+		t.Errorf("Expected every entry in the store after Close, got %d", len(store.data))
+	}
+}
+
+func TestWriteBackSetDoesNotBlockOnSlowStore(t *testing.T) {
+	ctx := context.Background()
+	store := &slowStore{memStore: newMemStore(), started: make(chan struct{}), release: make(chan struct{})}
+	entrySize := int64(len("key000") + len("value000") + 10)
+	cache := NewWriteBackCache(store, 10*entrySize, 1, 5)
+
+	// Sets evict batches of dirty entries, the first flush hangs in the store while the rest go on
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			cache.Set(ctx, []byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%03d", i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-store.started:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected evicting dirty entries to start a flush")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		close(store.release)
+		t.Fatalf("Expected Set not to wait for the store")
+	}
+
+	close(store.release)
+	if err := cache.Close(ctx); err != nil {
+		t.Fatalf("Unexpected close error %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		if value, ok := store.get(key); !ok || string(value) != fmt.Sprintf("value%03d", i) {
+			t.Fatalf("Expected %s in the store after Close, got %q, %v", key, value, ok)
+		}
+	}
+}
+
+func TestWriteBackFailedFlushKeepsEntriesDirty(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	cache := NewWriteBackCache(store, 4096, 1, 16)
+
+	cache.Set(ctx, []byte("a"), []byte("1"))
+	store.failPuts = true
+	if err := cache.Flush(ctx); err == nil {
+		t.Fatalf("Expected the flush to fail")
+	}
+
+	// A newer value set meanwhile wins over the one that failed
+	cache.Set(ctx, []byte("a"), []byte("2"))
+	store.failPuts = false
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatalf("Unexpected flush error %v", err)
+	}
+	if value, _ := store.get("a"); string(value) != "2" {
+		t.Errorf("Expected the latest value to be flushed, got %q", value)
+	}
+}
+
+func TestWriteBackFlusher(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	cache := NewWriteBackCache(store, 4096, 1, 16)
+	cache.StartFlusher(2 * time.Millisecond)
+	defer cache.StopFlusher()
+
+	cache.Set(ctx, []byte("a"), []byte("1"))
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := store.get("a"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the background flusher to write the entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteBackFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := fileStore{dir: t.TempDir()}
+	cache := NewWriteBackCache(store, 4096, 1, 4, WithOnEvict(func(key, value []byte, reason EvictReason) {}))
+
+	cache.Set(ctx, []byte("a"), []byte("1"))
+	cache.Set(ctx, []byte("b"), []byte("2"))
+	cache.Del(ctx, []byte("b"))
+	if err := cache.Close(ctx); err != nil {
+		t.Fatalf("Unexpected close error %v", err)
+	}
+
+	// A fresh cache over the same directory reads what was flushed
+	reopened := NewWriteThroughCache(store, 4096, 1)
+	if value, err := reopened.Get(ctx, []byte("a")); err != nil || string(value) != "1" {
+		t.Errorf("Expected a -> 1 from the file store, got %q, %v", value, err)
+	}
+	if _, err := reopened.Get(ctx, []byte("b")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected b to be deleted from the file store, got %v", err)
+	}
+}
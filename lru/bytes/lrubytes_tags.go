@@ -0,0 +1,113 @@
+package lrubytes
+
+import (
+	"sync/atomic"
+	"time"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// SetWithTags stores the value under key like Set and files it under every tag so InvalidateTag
+// can remove it. Each tag costs its length plus a constant overhead in the memory budget, and
+// the entry leaves the tag index whenever it leaves the cache. Tags are not kept in snapshots.
+func (c *Cache) SetWithTags(key, value []byte, tags ...[]byte) error {
+	owned := make([]string, len(tags))
+	for i, tag := range tags {
+		owned[i] = string(tag)
+	}
+	memSize := c.estimateMemory(key, value) + tagMemory(owned)
+	if c.copyOnSet {
+		key, value = clone(key, value)
+	}
+
+	var expireAt int64
+	if c.defaultTTL > 0 {
+		expireAt = time.Now().Add(c.defaultTTL).UnixNano()
+	}
+
+	c.mu.Lock()
+	c.set(key, value, owned, memSize, expireAt)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return nil
+}
+
+// InvalidateTag removes every entry filed under tag and returns how many were removed and the
+// memory they freed, including their tags. WithOnEvict reports them as EvictDeleted.
+func (c *Cache) InvalidateTag(tag []byte) (int, int64) {
+	c.mu.Lock()
+	before := atomic.LoadInt64(&c.currentMemory)
+	removed := 0
+	for idx := range c.tagIndex[cx.B2s(tag)] {
+		c.remove(idx, EvictDeleted)
+		removed++
+	}
+	freed := before - atomic.LoadInt64(&c.currentMemory)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return removed, freed
+}
+
+// tagMemory estimates what filing an entry under tags costs
+func tagMemory(tags []string) int64 {
+	var size int64
+	for _, tag := range tags {
+		size += int64(len(tag) + 10) // Adding constant overhead for both index entries
+	}
+	return size
+}
+
+// tag files the entry at idx under tags, its memory is already accounted by set
+func (c *Cache) tag(idx uint64, tags []string) {
+	if c.entryTags == nil {
+		c.tagIndex = make(map[string]map[uint64]struct{})
+		c.entryTags = make(map[uint64][]string)
+	}
+	c.entryTags[idx] = tags
+	for _, tag := range tags {
+		entries, ok := c.tagIndex[tag]
+		if !ok {
+			entries = make(map[uint64]struct{})
+			c.tagIndex[tag] = entries
+		}
+		entries[idx] = struct{}{}
+	}
+}
+
+// untag drops the entry at idx from the tag index and releases the memory of its tags,
+// emptied tags are deleted so the index only holds tags still in use
+func (c *Cache) untag(idx uint64) {
+	tags, ok := c.entryTags[idx]
+	if !ok {
+		return
+	}
+	delete(c.entryTags, idx)
+	for _, tag := range tags {
+		entries := c.tagIndex[tag]
+		delete(entries, idx)
+		if len(entries) == 0 {
+			delete(c.tagIndex, tag)
+		}
+	}
+	c.adjustMemory(-tagMemory(tags))
+}
+
+// SetWithTags adds a tagged key-value pair to the appropriate shard, see Cache.SetWithTags
+func (sc *ShardedCache) SetWithTags(key, value []byte, tags ...[]byte) error {
+	return sc.getShard(key).SetWithTags(key, value, tags...)
+}
+
+// InvalidateTag removes the entries filed under tag from every shard, locking one shard at a time
+func (sc *ShardedCache) InvalidateTag(tag []byte) (int, int64) {
+	removed, freed := 0, int64(0)
+	for _, shard := range sc.shards {
+		n, size := shard.InvalidateTag(tag)
+		removed += n
+		freed += size
+	}
+	return removed, freed
+}
@@ -0,0 +1,195 @@
+package lrubytes
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkTags verifies the tag index and the entries agree and currentMemory covers exactly both
+func checkTags(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var memory int64
+	for idx, e := range c.entries {
+		memory += c.estimateMemory(e.key, e.value) + tagMemory(c.entryTags[idx])
+	}
+	if memory != c.currentMemory {
+		t.Fatalf("Entries and tags hold %d bytes, currentMemory is %d", memory, c.currentMemory)
+	}
+	for idx, tags := range c.entryTags {
+		if _, ok := c.entries[idx]; !ok {
+			t.Fatalf("Entry %d left the cache but still has tags %v", idx, tags)
+		}
+		for _, tag := range tags {
+			if _, ok := c.tagIndex[tag][idx]; !ok {
+				t.Fatalf("Entry %d is not filed under its tag %s", idx, tag)
+			}
+		}
+	}
+	for tag, entries := range c.tagIndex {
+		if len(entries) == 0 {
+			t.Fatalf("Tag %s is empty but still indexed", tag)
+		}
+		for idx := range entries {
+			if _, ok := c.entryTags[idx]; !ok {
+				t.Fatalf("Tag %s lists entry %d which has no tags", tag, idx)
+			}
+		}
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	var mu sync.Mutex
+	var reasons []EvictReason
+	cache := NewLRUCache(4096, 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		mu.Lock()
+		reasons = append(reasons, reason)
+		mu.Unlock()
+	}))
+	cache.SetWithTags([]byte("order:1"), []byte("a"), []byte("user:1"), []byte("product:9"))
+	cache.SetWithTags([]byte("order:2"), []byte("b"), []byte("user:2"), []byte("product:9"))
+	cache.SetWithTags([]byte("order:3"), []byte("c"), []byte("user:1"))
+	cache.Set([]byte("plain"), []byte("d"))
+
+	want := cache.estimateMemory([]byte("order:1"), []byte("a")) + tagMemory([]string{"user:1", "product:9"}) +
+		cache.estimateMemory([]byte("order:3"), []byte("c")) + tagMemory([]string{"user:1"})
+	removed, freed := cache.InvalidateTag([]byte("user:1"))
+	if removed != 2 || freed != want {
+		t.Errorf("Expected 2 entries and %d bytes freed, got %d entries and %d bytes", want, removed, freed)
+	}
+	for key, cached := range map[string]bool{"order:1": false, "order:2": true, "order:3": false, "plain": true} {
+		if _, ok := cache.Get([]byte(key)); ok != cached {
+			t.Errorf("Expected %s cached: %v, got %v", key, cached, ok)
+		}
+	}
+	if removed, freed := cache.InvalidateTag([]byte("user:1")); removed != 0 || freed != 0 {
+		t.Errorf("Expected an invalidated tag to be gone, removed %d entries and %d bytes", removed, freed)
+	}
+	if removed, _ := cache.InvalidateTag([]byte("product:9")); removed != 1 {
+		t.Errorf("Expected order:2 removed by its other tag, removed %d", removed)
+	}
+	checkTags(t, cache)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != 3 || reasons[0] != EvictDeleted {
+		t.Errorf("Expected 3 EvictDeleted callbacks, got %v", reasons)
+	}
+}
+
+func TestTagIndexCleanup(t *testing.T) {
+	cache := NewLRUCache(4096, 1)
+	cache.SetWithTags([]byte("key1"), []byte("value"), []byte("tag"))
+	cache.SetWithTags([]byte("key2"), []byte("value"), []byte("tag"))
+	cache.SetWithTags([]byte("key3"), []byte("value"), []byte("other"))
+
+	cache.Del([]byte("key1"))
+	cache.Set([]byte("key2"), []byte("untagged")) // Overwriting drops the old tags
+	cache.DelPrefix([]byte("key3"))
+	checkTags(t, cache)
+	if len(cache.tagIndex) != 0 || len(cache.entryTags) != 0 {
+		t.Errorf("Expected an empty tag index, got %v and %v", cache.tagIndex, cache.entryTags)
+	}
+	if removed, _ := cache.InvalidateTag([]byte("tag")); removed != 0 {
+		t.Errorf("Expected the overwritten key2 to have lost its tag, removed %d", removed)
+	}
+}
+
+func TestTagsCountInBudget(t *testing.T) {
+	value := []byte("value")
+	entrySize := NewLRUCache(0, 1).estimateMemory([]byte("key0"), value)
+	tagSize := tagMemory([]string{"tag"})
+
+	// Room for 5 untagged entries, but only 3 once each carries a tag
+	cache := NewLRUCache(3*(entrySize+tagSize), 1)
+	for i := 0; i < 4; i++ {
+		cache.SetWithTags([]byte(fmt.Sprintf("key%d", i)), value, []byte("tag"))
+	}
+	if cache.Len() != 3 {
+		t.Errorf("Expected the tags to leave room for 3 entries, got %d", cache.Len())
+	}
+	if stats := cache.Stats(); stats.Bytes != 3*(entrySize+tagSize) {
+		t.Errorf("Expected %d bytes, got %d", 3*(entrySize+tagSize), stats.Bytes)
+	}
+	checkTags(t, cache)
+
+	if removed, _ := cache.InvalidateTag([]byte("tag")); removed != 3 || cache.Stats().Bytes != 0 {
+		t.Errorf("Expected every entry removed and no memory left, got %d removed and %d bytes", removed, cache.Stats().Bytes)
+	}
+}
+
+func TestTagsCountInBudgetWithTinyLFU(t *testing.T) {
+	cache := NewLRUCache(4096, 1, WithTinyLFU(0))
+	tags := make([][]byte, 8)
+	for i := range tags {
+		tags[i] = []byte(fmt.Sprintf("a-rather-long-tag-name-%d", i))
+	}
+
+	// Tags weigh several times the entries, the segments alone would let the cache overflow
+	for i := 0; i < 500; i++ {
+		cache.SetWithTags([]byte(fmt.Sprintf("key%d", i)), []byte("value"), tags...)
+		if stats := cache.Stats(); stats.Bytes > stats.MaxBytes {
+			t.Fatalf("Set %d: %d bytes cached over a limit of %d", i, stats.Bytes, stats.MaxBytes)
+		}
+	}
+	if cache.Len() == 0 {
+		t.Errorf("Expected tagged entries to be cached")
+	}
+	if _, ok := cache.Get([]byte("key499")); !ok {
+		t.Errorf("Expected the entry just set to stay in the window")
+	}
+	checkTags(t, cache)
+}
+
+func TestTagsExpireAndEvict(t *testing.T) {
+	cache := NewLRUCache(2048, 1, WithDefaultTTL(time.Millisecond))
+	cache.SetWithTags([]byte("expiring"), []byte("value"), []byte("tag"))
+	time.Sleep(2 * time.Millisecond)
+	cache.DeleteExpired()
+	checkTags(t, cache)
+
+	lfu := NewLRUCache(2048, 1, WithTinyLFU(0))
+	for i := 0; i < 200; i++ {
+		lfu.SetWithTags([]byte(fmt.Sprintf("key%d", i)), make([]byte, 64), []byte(fmt.Sprintf("tag%d", i%7)))
+	}
+	checkTags(t, lfu)
+}
+
+func TestShardedTags(t *testing.T) {
+	cache := NewShardedCache(8, 64*1024, 1)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := []byte(fmt.Sprintf("key%d-%d", g, i))
+				cache.SetWithTags(key, []byte("value"), []byte(fmt.Sprintf("user:%d", i%10)), []byte("all"))
+				if i%50 == 0 {
+					cache.InvalidateTag([]byte(fmt.Sprintf("user:%d", g)))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, shard := range cache.shards {
+		checkTags(t, shard)
+	}
+
+	total := cache.Len()
+	removed, _ := cache.InvalidateTag([]byte("user:9"))
+	if removed == 0 || cache.Len() != total-removed {
+		t.Errorf("Expected user:9 entries removed across shards, removed %d of %d", removed, total)
+	}
+	removed, freed := cache.InvalidateTag([]byte("all"))
+	if removed == 0 || freed <= 0 || cache.Len() != 0 || cache.Stats().Bytes != 0 {
+		t.Errorf("Expected the shared tag to empty the cache, %d left and %d bytes", cache.Len(), cache.Stats().Bytes)
+	}
+	for _, shard := range cache.shards {
+		checkTags(t, shard)
+	}
+}
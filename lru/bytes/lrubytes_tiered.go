@@ -0,0 +1,136 @@
+package lrubytes
+
+import "sync"
+
+// TieredCache puts a ShardedCache in front of an on-disk segment store. Entries evicted from
+// memory for lack of room spill to disk, a memory miss falls back to disk and promotes the entry
+// back into memory. The disk tier has its own byte budget and survives restarts: reopening the
+// directory recovers every intact record, dropping whatever a crash left half written.
+//
+// An entry promoted from disk keeps its disk copy, so evicting it again costs no write, while Set
+// and Del remove the disk copy of the key. Entries expiring in memory are not spilled and lose
+// their disk copy, the disk tier keeps no TTLs. Memory hits only take the shard locks, but memory
+// misses, Sets and Dels are serialized on the disk tier.
+type TieredCache struct {
+	memory    *ShardedCache
+	disk      *segmentStore
+	mu        sync.Mutex // Guards disk and orders the spills with the Sets and Dels of the same key
+	err       error      // First disk error nobody could be told about, returned by Close
+	expiredMu sync.Mutex
+	expired   [][]byte // Keys expired in memory whose disk copy is dropped on the next lock
+}
+
+// NewTieredCache opens a tiered cache keeping memoryBytes in shardCount memory shards and up to
+// diskBytes in segments under dir. The options apply to the memory shards.
+func NewTieredCache(dir string, shardCount uint8, memoryBytes int64, evictionCount int, diskBytes int64, opts ...Option) (*TieredCache, error) {
+	disk, err := openSegmentStore(dir, diskBytes)
+	if err != nil {
+		return nil, err
+	}
+	tc := &TieredCache{disk: disk}
+	tc.memory = NewShardedCache(shardCount, memoryBytes, evictionCount, append(opts, tc.spillEvictions)...)
+	return tc, nil
+}
+
+// spillEvictions chains onto any EvictFunc from the caller's options. Capacity evictions only
+// happen in memory Sets, which all run under tc.mu, so the spill does not lock again. Expiry
+// happens in Gets that may not hold it, so the key is queued instead.
+func (tc *TieredCache) spillEvictions(c *Cache) {
+	next := c.onEvict
+	c.onEvict = func(key, value []byte, reason EvictReason) {
+		switch reason {
+		case EvictCapacity:
+			if !tc.disk.has(key) {
+				tc.keepErr(tc.disk.put(key, value))
+			}
+		case EvictExpired:
+			tc.expiredMu.Lock()
+			tc.expired = append(tc.expired, key)
+			tc.expiredMu.Unlock()
+		}
+		if next != nil {
+			next(key, value, reason)
+		}
+	}
+}
+
+// lock takes tc.mu and drops the disk copies of the keys that expired meanwhile
+func (tc *TieredCache) lock() {
+	tc.mu.Lock()
+	tc.dropExpired()
+}
+
+// dropExpired deletes the disk copies of the keys expired in memory, caller must hold tc.mu
+func (tc *TieredCache) dropExpired() {
+	tc.expiredMu.Lock()
+	expired := tc.expired
+	tc.expired = nil
+	tc.expiredMu.Unlock()
+	for _, key := range expired {
+		tc.keepErr(tc.disk.del(key))
+	}
+}
+
+func (tc *TieredCache) keepErr(err error) {
+	if tc.err == nil {
+		tc.err = err
+	}
+}
+
+// Get returns the value of key from memory, or from disk promoting it back into memory
+func (tc *TieredCache) Get(key []byte) ([]byte, bool) {
+	if value, ok := tc.memory.Get(key); ok {
+		return value, true
+	}
+
+	tc.lock()
+	defer tc.mu.Unlock()
+	// Another Get may have promoted it meanwhile
+	if value, ok := tc.memory.Get(key); ok {
+		return value, true
+	}
+	tc.dropExpired() // The Get above may have expired the key
+	value, ok, err := tc.disk.get(key)
+	if !ok {
+		tc.keepErr(err)
+		return nil, false
+	}
+	tc.memory.Set(key, value)
+	return value, true
+}
+
+// Set stores value under key in memory, replacing any copy on disk
+func (tc *TieredCache) Set(key, value []byte) error {
+	tc.lock()
+	defer tc.mu.Unlock()
+	err := tc.disk.del(key)
+	tc.memory.Set(key, value)
+	return err
+}
+
+// Del removes key from memory and disk
+func (tc *TieredCache) Del(key []byte) error {
+	tc.lock()
+	defer tc.mu.Unlock()
+	tc.memory.Del(key)
+	return tc.disk.del(key)
+}
+
+// DiskLen returns the number of entries on disk, entries promoted to memory included
+func (tc *TieredCache) DiskLen() int {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return len(tc.disk.index)
+}
+
+// Close syncs and closes the disk tier, the entries only held in memory are lost. The cache must
+// not be used afterwards.
+func (tc *TieredCache) Close() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	err := tc.disk.close()
+	if tc.err != nil {
+		return tc.err
+	}
+	return err
+}
@@ -0,0 +1,319 @@
+package lrubytes
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTiered(t *testing.T, dir string, memoryBytes, diskBytes int64, opts ...Option) *TieredCache {
+	t.Helper()
+	cache, err := NewTieredCache(dir, 1, memoryBytes, 1, diskBytes, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return cache
+}
+
+// checkSegments verifies the disk index, the live byte counts and the byte budget agree
+func checkSegments(t *testing.T, s *segmentStore) {
+	t.Helper()
+	live := make(map[*segment]int64)
+	for _, loc := range s.index {
+		live[loc.segment] += loc.size
+	}
+	var total int64
+	for _, seg := range s.segments {
+		if live[seg] != seg.live {
+			t.Fatalf("Segment %d has %d live bytes indexed, counts %d", seg.id, live[seg], seg.live)
+		}
+		info, err := seg.file.Stat()
+		if err != nil || info.Size() != seg.size {
+			t.Fatalf("Segment %d file is %d bytes, expected %d (%v)", seg.id, info.Size(), seg.size, err)
+		}
+		delete(live, seg)
+		total += seg.size
+	}
+	if len(live) != 0 {
+		t.Fatalf("Index points at %d removed segments", len(live))
+	}
+	if total != s.total {
+		t.Fatalf("Segments hold %d bytes, total is %d", total, s.total)
+	}
+}
+
+func TestTieredSpillAndPromote(t *testing.T) {
+	entrySize := int64(len("key00") + len("value00") + 10)
+	cache := openTiered(t, t.TempDir(), 10*entrySize, 1<<20)
+	defer cache.Close()
+
+	for i := 0; i < 50; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%02d", i)))
+	}
+	if cache.DiskLen() != 40 {
+		t.Errorf("Expected the 40 entries evicted from memory on disk, got %d", cache.DiskLen())
+	}
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if value, ok := cache.Get([]byte(key)); !ok || string(value) != fmt.Sprintf("value%02d", i) {
+			t.Fatalf("Expected %s from memory or disk, got %q, %v", key, value, ok)
+		}
+	}
+	if _, ok := cache.memory.getShard([]byte("key00")).Get([]byte("key00")); ok {
+		t.Errorf("Expected key00, promoted early on, to be evicted again by the later promotions")
+	}
+	if _, ok := cache.memory.getShard([]byte("key49")).Get([]byte("key49")); !ok {
+		t.Errorf("Expected key49, read last, to be promoted back into memory")
+	}
+	checkSegments(t, cache.disk)
+}
+
+func TestTieredSetAndDelReplaceDiskCopy(t *testing.T) {
+	dir := t.TempDir()
+	entrySize := int64(len("key0") + len("new") + 10)
+	cache := openTiered(t, dir, 2*entrySize, 1<<20)
+
+	for i := 0; i < 4; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte("old"))
+	}
+	// key0 and key1 are on disk, updating and deleting them must not leave the old copy behind
+	cache.Set([]byte("key0"), []byte("new"))
+	cache.Del([]byte("key1"))
+	cache.Set([]byte("key4"), []byte("new"))
+	cache.Set([]byte("key5"), []byte("new"))
+
+	if value, ok := cache.Get([]byte("key0")); !ok || string(value) != "new" {
+		t.Errorf("Expected key0 -> new, got %q, %v", value, ok)
+	}
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	checkSegments(t, cache.disk)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Unexpected close error %v", err)
+	}
+
+	// The tombstone keeps key1 deleted after a restart
+	reopened := openTiered(t, dir, 2*entrySize, 1<<20)
+	defer reopened.Close()
+	if _, ok := reopened.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to stay deleted after a restart")
+	}
+	if value, ok := reopened.Get([]byte("key0")); !ok || string(value) != "new" {
+		t.Errorf("Expected key0 -> new after a restart, got %q, %v", value, ok)
+	}
+}
+
+func TestTieredSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cache := openTiered(t, dir, 256, 1<<20)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	onDisk := cache.DiskLen()
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Unexpected close error %v", err)
+	}
+
+	reopened := openTiered(t, dir, 256, 1<<20)
+	defer reopened.Close()
+	if reopened.DiskLen() != onDisk {
+		t.Fatalf("Expected %d entries recovered, got %d", onDisk, reopened.DiskLen())
+	}
+	if value, ok := reopened.Get([]byte("key0")); !ok || string(value) != "value0" {
+		t.Errorf("Expected key0 -> value0 after a restart, got %q, %v", value, ok)
+	}
+	checkSegments(t, reopened.disk)
+}
+
+func TestTieredRecoversFromTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openSegmentStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	store.put([]byte("a"), []byte("1"))
+	store.put([]byte("b"), []byte("2"))
+	store.put([]byte("c"), []byte("3"))
+	name := store.active().file.Name()
+	size := store.active().size
+	store.close()
+
+	// Simulate a crash in the middle of writing c, then flip a byte of b
+	if err := os.Truncate(name, size-2); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := openSegmentStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, ok, _ := recovered.get([]byte("c")); ok {
+		t.Errorf("Expected the torn record to be dropped")
+	}
+	if value, ok, _ := recovered.get([]byte("b")); !ok || string(value) != "2" {
+		t.Errorf("Expected b -> 2, got %q, %v", value, ok)
+	}
+	checkSegments(t, recovered)
+	recovered.close()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(name, data, 0o644)
+	recovered, err = openSegmentStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer recovered.close()
+	if _, ok, _ := recovered.get([]byte("b")); ok {
+		t.Errorf("Expected the record failing its checksum to be dropped")
+	}
+	if value, ok, _ := recovered.get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	checkSegments(t, recovered)
+}
+
+func TestTieredReopenWithSmallerBudget(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openSegmentStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	store.put([]byte("a"), []byte("old"))
+	store.put([]byte("c"), []byte("old"))
+	store.put([]byte("c"), make([]byte, 3000))
+	store.put([]byte("b"), []byte("2"))
+	store.put([]byte("a"), []byte("1"))
+	store.close()
+
+	// The large c no longer fits, the records after it are still intact
+	recovered, err := openSegmentStore(dir, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if value, ok, _ := recovered.get([]byte(key)); !ok || string(value) != want {
+			t.Errorf("Expected %s -> %s, got %q, %v", key, want, value, ok)
+		}
+	}
+	if value, ok, _ := recovered.get([]byte("c")); ok {
+		t.Errorf("Expected c dropped rather than its older value back, got %q", value)
+	}
+	if recovered.total > recovered.maxBytes {
+		t.Errorf("Expected the store within %d bytes, got %d", recovered.maxBytes, recovered.total)
+	}
+	checkSegments(t, recovered)
+	recovered.close()
+
+	recovered, err = openSegmentStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer recovered.close()
+	if _, ok, _ := recovered.get([]byte("c")); ok || len(recovered.index) != 2 {
+		t.Errorf("Expected a and b to be all that is left, got %d keys", len(recovered.index))
+	}
+	checkSegments(t, recovered)
+}
+
+func TestTieredCompactionAndBudget(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openSegmentStore(dir, 64*1024)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer store.close()
+
+	// Rewriting the same keys over and over turns the old segments into garbage
+	value := make([]byte, 100)
+	for i := 0; i < 5000; i++ {
+		store.put([]byte(fmt.Sprintf("key%d", i%50)), value)
+	}
+	if len(store.index) != 50 {
+		t.Errorf("Expected compaction to keep all 50 keys, got %d", len(store.index))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(files) != len(store.segments) || store.total > store.maxBytes {
+		t.Errorf("Expected old segments to be removed, %d files, %d segments, %d bytes", len(files), len(store.segments), store.total)
+	}
+	checkSegments(t, store)
+
+	// More distinct data than the budget drops the oldest entries
+	for i := 0; i < 2000; i++ {
+		store.put([]byte(fmt.Sprintf("distinct%d", i)), value)
+	}
+	if store.total > store.maxBytes {
+		t.Errorf("Expected the store within %d bytes, got %d", store.maxBytes, store.total)
+	}
+	if _, ok, _ := store.get([]byte("distinct0")); ok {
+		t.Errorf("Expected the oldest entries to be dropped")
+	}
+	if value, ok, _ := store.get([]byte("distinct1999")); !ok || len(value) != 100 {
+		t.Errorf("Expected the newest entry on disk")
+	}
+	checkSegments(t, store)
+}
+
+func TestTieredExpiredEntriesLeaveDisk(t *testing.T) {
+	entrySize := int64(len("key0") + len("value") + 10)
+	cache := openTiered(t, t.TempDir(), 2*entrySize, 1<<20, WithDefaultTTL(5*time.Millisecond))
+	defer cache.Close()
+
+	cache.Set([]byte("key0"), []byte("value"))
+	cache.Set([]byte("key1"), []byte("value"))
+	cache.Set([]byte("key2"), []byte("value"))
+	// key0 spilled, promoting it back keeps its disk copy
+	if _, ok := cache.Get([]byte("key0")); !ok {
+		t.Fatalf("Expected key0 from disk")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := cache.Get([]byte("key0")); ok {
+		t.Errorf("Expected key0 to expire instead of being read back from disk")
+	}
+	if cache.DiskLen() != 1 {
+		t.Errorf("Expected only key1 left on disk, got %d entries", cache.DiskLen())
+	}
+}
+
+func TestTieredRandomOperations(t *testing.T) {
+	dir := t.TempDir()
+	cache := openTiered(t, dir, 2048, 16*1024)
+	model := make(map[string]string)
+	rng := rand.New(rand.NewSource(6))
+
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("key%d", rng.Intn(400))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del([]byte(key))
+			delete(model, key)
+		case 1:
+			value := fmt.Sprintf("%d-%s", i, make([]byte, rng.Intn(32)))
+			cache.Set([]byte(key), []byte(value))
+			model[key] = value
+		default:
+			// The disk budget may have dropped it, but a hit must be the latest value
+			if got, ok := cache.Get([]byte(key)); ok && string(got) != model[key] {
+				t.Fatalf("Expected %s -> %q, got %q", key, model[key], got)
+			}
+		}
+	}
+	checkSegments(t, cache.disk)
+	cache.Close()
+
+	reopened := openTiered(t, dir, 2048, 16*1024)
+	defer reopened.Close()
+	for key, value := range model {
+		if got, ok := reopened.Get([]byte(key)); ok && string(got) != value {
+			t.Fatalf("Expected %s -> %q after a restart, got %q", key, value, got)
+		}
+	}
+	checkSegments(t, reopened.disk)
+}
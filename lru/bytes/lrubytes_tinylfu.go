@@ -0,0 +1,186 @@
+package lrubytes
+
+import (
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/zeebo/xxh3"
+)
+
+// WithTinyLFU puts a W-TinyLFU admission filter in front of the cache: new entries land in a
+// small LRU window (1% of the memory), and an entry leaving the window only displaces the
+// least recently used entry of the main segmented LRU if it has been seen more often.
+// One-off scans then pass through the window without flushing the frequently used entries.
+//
+// expectedItems sizes the frequency sketch, 0 estimates it from the memory limit. The sketch
+// takes about expectedItems bytes on top of the memory limit.
+func WithTinyLFU(expectedItems int) Option {
+	return func(c *Cache) {
+		if expectedItems <= 0 {
+			expectedItems = int(c.maxMemory / 256)
+		}
+		c.sketch = newFrequencySketch(expectedItems)
+		c.windowMax = c.maxMemory / 100
+		c.protectedMax = (c.maxMemory - c.windowMax) * 8 / 10
+	}
+}
+
+// admit moves entries overflowing the window into probation when they are more frequently used
+// than the main segment's victim, caller must hold the write lock
+func (c *Cache) admit() {
+	window := &c.lists[segmentLRU]
+	mainMax := c.maxMemory - c.windowMax
+
+	for window.memory > c.windowMax && window.tail != InvalidIndex {
+		candidate := window.tail
+		candidateEntry := c.entries[candidate]
+		candidateSize := c.estimateMemory(candidateEntry.key, candidateEntry.value)
+		candidateFreq := c.sketch.estimate(xxh3.Hash(candidateEntry.key))
+
+		admitted := true
+		for c.lists[segmentProbation].memory+c.lists[segmentProtected].memory+candidateSize > mainMax {
+			victim := c.lists[segmentProbation].tail
+			if victim == InvalidIndex {
+				victim = c.lists[segmentProtected].tail
+			}
+			if victim == InvalidIndex || candidateFreq <= c.sketch.estimate(xxh3.Hash(c.entries[victim].key)) {
+				admitted = false
+				break
+			}
+			c.remove(victim, EvictCapacity)
+		}
+
+		if !admitted {
+			c.remove(candidate, EvictCapacity)
+			continue
+		}
+		c.detach(candidate)
+		c.linkFront(candidate, segmentProbation)
+	}
+
+	// The segments only measure keys and values, tags can still push the cache past its limit.
+	// Take the overflow from the main segment first, the window holds what was just set
+	for atomic.LoadInt64(&c.currentMemory) > c.maxMemory {
+		victim := c.lists[segmentProbation].tail
+		if victim == InvalidIndex {
+			victim = c.lists[segmentProtected].tail
+		}
+		if victim == InvalidIndex {
+			victim = window.tail
+		}
+		if victim == InvalidIndex {
+			return
+		}
+		c.remove(victim, EvictCapacity)
+	}
+}
+
+// frequencySketch is a count-min sketch of 4-bit counters with a doorkeeper bloom filter in
+// front of it, so keys seen only once never reach the counters. All counters are halved and
+// the doorkeeper cleared after a sample of 10 accesses per counter, letting old popularity fade.
+type frequencySketch struct {
+	table      []uint64 // sketchDepth rows of width counters, 16 per word
+	width      uint64   // counters per row, a power of two
+	doorkeeper []uint64
+	doorMask   uint64
+	additions  int
+	sampleSize int
+}
+
+const (
+	sketchDepth   = 4
+	counterMax    = 15
+	halfCounters  = 0x7777777777777777 // Clears the bit shifted into each counter when halving
+	doorkeeperK   = 3
+	minSketchSize = 64
+)
+
+func newFrequencySketch(expectedItems int) *frequencySketch {
+	width := uint64(minSketchSize)
+	if expectedItems > minSketchSize {
+		width = 1 << bits.Len64(uint64(expectedItems-1))
+	}
+	doorBits := width * 8
+	return &frequencySketch{
+		table:      make([]uint64, sketchDepth*width/16),
+		width:      width,
+		doorkeeper: make([]uint64, doorBits/64),
+		doorMask:   doorBits - 1,
+		sampleSize: 10 * int(width),
+	}
+}
+
+// counter locates the counter of row i for a hash as a word index and bit shift
+func (s *frequencySketch) counter(hash uint64, i uint64) (uint64, uint64) {
+	h := uint64(uint32(hash)) + i*(hash>>32) // Kirsch-Mitzenmacher double hashing
+	slot := i*s.width + (h & (s.width - 1))
+	return slot / 16, (slot % 16) * 4
+}
+
+// increment records one access of the key with the given hash
+func (s *frequencySketch) increment(hash uint64) {
+	if !s.doorkeeperAdd(hash) {
+		return
+	}
+	for i := uint64(0); i < sketchDepth; i++ {
+		word, shift := s.counter(hash, i)
+		if (s.table[word]>>shift)&counterMax < counterMax {
+			s.table[word] += 1 << shift
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate returns how often the key with the given hash was seen recently
+func (s *frequencySketch) estimate(hash uint64) uint64 {
+	count := uint64(counterMax)
+	for i := uint64(0); i < sketchDepth; i++ {
+		word, shift := s.counter(hash, i)
+		count = min(count, (s.table[word]>>shift)&counterMax)
+	}
+	if s.doorkeeperContains(hash) {
+		count++
+	}
+	return count
+}
+
+// reset ages the sketch by halving every counter and clearing the doorkeeper
+func (s *frequencySketch) reset() {
+	for i := range s.table {
+		s.table[i] = (s.table[i] >> 1) & halfCounters
+	}
+	clear(s.doorkeeper)
+	s.additions /= 2
+}
+
+func (s *frequencySketch) doorkeeperBit(hash uint64, i uint64) (uint64, uint64) {
+	bit := bits.RotateLeft64(hash, int(i)*21) & s.doorMask
+	return bit / 64, bit % 64
+}
+
+// doorkeeperAdd reports whether the hash was already present, adding it if not
+func (s *frequencySketch) doorkeeperAdd(hash uint64) bool {
+	present := true
+	for i := uint64(0); i < doorkeeperK; i++ {
+		word, bit := s.doorkeeperBit(hash, i)
+		if s.doorkeeper[word]&(1<<bit) == 0 {
+			present = false
+			s.doorkeeper[word] |= 1 << bit
+		}
+	}
+	return present
+}
+
+func (s *frequencySketch) doorkeeperContains(hash uint64) bool {
+	for i := uint64(0); i < doorkeeperK; i++ {
+		word, bit := s.doorkeeperBit(hash, i)
+		if s.doorkeeper[word]&(1<<bit) == 0 {
+			return false
+		}
+	}
+	return true
+}
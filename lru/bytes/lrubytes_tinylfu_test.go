@@ -0,0 +1,152 @@
+package lrubytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// checkInvariants verifies the lists, index and memory accounting agree with each other
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	linked := 0
+	var total int64
+	for segment := range c.lists {
+		l := c.lists[segment]
+		var memory int64
+		prev := InvalidIndex
+		for idx := l.head; idx != InvalidIndex; idx = c.entries[idx].next {
+			e, ok := c.entries[idx]
+			if !ok {
+				t.Fatalf("Segment %d links missing entry %d", segment, idx)
+			}
+			if e.segment != uint8(segment) || e.prev != prev {
+				t.Fatalf("Entry %d has segment %d prev %d, expected %d and %d", idx, e.segment, e.prev, segment, prev)
+			}
+			if c.indexMap[string(e.key)] != idx {
+				t.Fatalf("Index of %q does not point at entry %d", e.key, idx)
+			}
+			memory += c.estimateMemory(e.key, e.value)
+			prev = idx
+			linked++
+		}
+		if l.tail != prev {
+			t.Fatalf("Segment %d tail is %d, expected %d", segment, l.tail, prev)
+		}
+		if l.memory != memory {
+			t.Fatalf("Segment %d accounts %d bytes, entries add up to %d", segment, l.memory, memory)
+		}
+		total += memory
+	}
+	if linked != len(c.entries) || linked != len(c.indexMap) {
+		t.Fatalf("%d linked entries, %d entries, %d index keys", linked, len(c.entries), len(c.indexMap))
+	}
+	if total != c.currentMemory {
+		t.Fatalf("Segments hold %d bytes, currentMemory is %d", total, c.currentMemory)
+	}
+	if c.currentMemory > c.maxMemory {
+		t.Fatalf("currentMemory %d exceeds maxMemory %d", c.currentMemory, c.maxMemory)
+	}
+}
+
+// scanTrace mixes a small frequently used hot set with long one-off scans
+func scanTrace(n int) [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	trace := make([][]byte, 0, n)
+	scan := 0
+	for len(trace) < n {
+		for i := 0; i < 400 && len(trace) < n; i++ {
+			trace = append(trace, []byte(fmt.Sprintf("hot%d", rng.Intn(100))))
+		}
+		for i := 0; i < 300 && len(trace) < n; i++ {
+			trace = append(trace, []byte(fmt.Sprintf("scan%d", scan)))
+			scan++
+		}
+	}
+	return trace
+}
+
+// hitRatio replays a read-through workload, every miss is followed by a Set
+func hitRatio(c *Cache, trace [][]byte) float64 {
+	value := make([]byte, 32)
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Set(key, value)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestTinyLFUBeatsLRUOnScans(t *testing.T) {
+	trace := scanTrace(100000)
+	entrySize := int64(len("scan00000") + 32 + 10)
+
+	lru := NewLRUCache(150*entrySize, 1)
+	tinyLFU := NewLRUCache(150*entrySize, 1, WithTinyLFU(0))
+
+	lruRatio := hitRatio(lru, trace)
+	tinyLFURatio := hitRatio(tinyLFU, trace)
+	t.Logf("LRU hit ratio %.3f, W-TinyLFU hit ratio %.3f", lruRatio, tinyLFURatio)
+
+	if tinyLFURatio <= lruRatio+0.1 {
+		t.Errorf("Expected W-TinyLFU (%.3f) to clearly beat LRU (%.3f) on a scan heavy trace", tinyLFURatio, lruRatio)
+	}
+	checkInvariants(t, tinyLFU)
+}
+
+func TestTinyLFUKeepsAPI(t *testing.T) {
+	cache := NewLRUCache(4096, 1, WithTinyLFU(0))
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 20000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(500)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+	}
+	checkInvariants(t, cache)
+
+	cache.Set([]byte("fresh"), []byte("value"))
+	if value, ok := cache.Get([]byte("fresh")); !ok || string(value) != "value" {
+		t.Errorf("Expected a fresh key to be readable from the window, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("fresh"))
+	if _, ok := cache.Get([]byte("fresh")); ok {
+		t.Errorf("Expected Del to remove the key")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestFrequencySketch(t *testing.T) {
+	sketch := newFrequencySketch(1000)
+	hot, cold := uint64(0x1234567890abcdef), uint64(0xfedcba0987654321)
+	for i := 0; i < 10; i++ {
+		sketch.increment(hot)
+	}
+	sketch.increment(cold)
+
+	if got := sketch.estimate(hot); got < 10 {
+		t.Errorf("Expected hot estimate of at least 10, got %d", got)
+	}
+	if got := sketch.estimate(cold); got != 1 {
+		t.Errorf("Expected a key seen once to only be in the doorkeeper, got %d", got)
+	}
+
+	sketch.reset()
+	if got := sketch.estimate(hot); got < 4 || got > 5 {
+		t.Errorf("Expected aging to halve the hot estimate, got %d", got)
+	}
+	if got := sketch.estimate(cold); got != 0 {
+		t.Errorf("Expected aging to clear the doorkeeper, got %d", got)
+	}
+}
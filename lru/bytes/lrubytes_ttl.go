@@ -0,0 +1,91 @@
+package lrubytes
+
+import (
+	"sync"
+	"time"
+)
+
+// WithDefaultTTL makes Set expire entries after ttl, SetWithTTL still overrides it per entry
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.defaultTTL = ttl
+	}
+}
+
+// expired reports whether the entry has a deadline that has already passed
+func (e *entry) expired() bool {
+	return e.expireAt != 0 && time.Now().UnixNano() >= e.expireAt
+}
+
+// DeleteExpired removes every expired entry and returns how many were removed
+func (c *Cache) DeleteExpired() int {
+	c.mu.Lock()
+	now := time.Now().UnixNano()
+	removed := 0
+	for segment := range c.lists {
+		for idx := c.lists[segment].tail; idx != InvalidIndex; {
+			entry := c.entries[idx]
+			prev := entry.prev
+			if entry.expireAt != 0 && now >= entry.expireAt {
+				c.remove(idx, EvictExpired)
+				removed++
+			}
+			idx = prev
+		}
+	}
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return removed
+}
+
+// StartSweeper runs DeleteExpired every interval in the background until StopSweeper is called
+func (c *Cache) StartSweeper(interval time.Duration) {
+	c.sweeper.start(interval, func() { c.DeleteExpired() })
+}
+
+// StopSweeper stops the background sweeper, it is a no-op if none is running
+func (c *Cache) StopSweeper() {
+	c.sweeper.stop()
+}
+
+// sweeper drives a periodic expiry pass on its own goroutine
+type sweeper struct {
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+func (s *sweeper) start(interval time.Duration, sweep func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil || interval <= 0 {
+		return
+	}
+	done := make(chan struct{})
+	s.done = done
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func (s *sweeper) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+}
@@ -0,0 +1,142 @@
+package lrubytes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetWithTTLExpiresOnGet(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.SetWithTTL([]byte("short"), []byte("value"), 10*time.Millisecond)
+	cache.Set([]byte("forever"), []byte("value"))
+
+	if _, ok := cache.Get([]byte("short")); !ok {
+		t.Fatalf("Expected 'short' to be present before its TTL")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := cache.Get([]byte("short")); ok {
+		t.Errorf("Expected 'short' to be expired")
+	}
+	if _, ok := cache.Get([]byte("forever")); !ok {
+		t.Errorf("Expected 'forever' to survive without a TTL")
+	}
+	if got, want := cache.currentMemory, cache.estimateMemory([]byte("forever"), []byte("value")); got != want {
+		t.Errorf("Expected currentMemory %d after lazy expiry, got %d", want, got)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	cache := NewLRUCache(1024, 1, WithDefaultTTL(10*time.Millisecond))
+	cache.Set([]byte("a"), []byte("1"))
+	cache.SetWithTTL([]byte("b"), []byte("2"), time.Hour)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected 'a' to expire with the default TTL")
+	}
+	if _, ok := cache.Get([]byte("b")); !ok {
+		t.Errorf("Expected 'b' to keep its explicit TTL")
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	cache.SetWithTTL([]byte("a"), []byte("1"), time.Millisecond)
+	cache.Set([]byte("b"), []byte("2"))
+	cache.SetWithTTL([]byte("c"), []byte("3"), time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if removed := cache.DeleteExpired(); removed != 2 {
+		t.Errorf("Expected 2 expired entries to be removed, got %d", removed)
+	}
+	if len(cache.entries) != 1 || len(cache.indexMap) != 1 {
+		t.Errorf("Expected 1 entry left, got %d entries and %d index keys", len(cache.entries), len(cache.indexMap))
+	}
+	if got, want := cache.currentMemory, cache.estimateMemory([]byte("b"), []byte("2")); got != want {
+		t.Errorf("Expected currentMemory %d, got %d", want, got)
+	}
+	if l := cache.lists[segmentLRU]; l.head != l.tail {
+		t.Errorf("Expected a single entry list, head %d tail %d", l.head, l.tail)
+	}
+}
+
+func TestSetOverwriteReleasesMemory(t *testing.T) {
+	cache := NewLRUCache(1024, 1)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte("key"), []byte("value"))
+	}
+	if got, want := cache.currentMemory, cache.estimateMemory([]byte("key"), []byte("value")); got != want {
+		t.Errorf("Expected currentMemory %d after overwrites, got %d", want, got)
+	}
+}
+
+func TestShardedSweeper(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1)
+	for i := 0; i < 16; i++ {
+		cache.SetWithTTL([]byte{byte(i)}, []byte("value"), time.Millisecond)
+	}
+	cache.StartSweeper(2 * time.Millisecond)
+	defer cache.StopSweeper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		remaining := 0
+		for _, shard := range cache.shards {
+			shard.mu.RLock()
+			remaining += len(shard.entries)
+			shard.mu.RUnlock()
+		}
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Errorf("Expected the sweeper to remove all expired entries")
+}
+
+func TestShardedSweeperDoesNotWaitForBusyShard(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1)
+	for i := 0; i < 64; i++ {
+		cache.SetWithTTL([]byte{byte(i)}, []byte("value"), time.Millisecond)
+	}
+	remaining := func(shard *Cache) int {
+		shard.mu.RLock()
+		defer shard.mu.RUnlock()
+		return len(shard.entries)
+	}
+
+	// A shard held locked must not keep the others from being swept
+	busy := cache.shards[0]
+	busy.mu.Lock()
+	cache.StartSweeper(2 * time.Millisecond)
+	defer cache.StopSweeper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		left := 0
+		for _, shard := range cache.shards[1:] {
+			left += remaining(shard)
+		}
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			busy.mu.Unlock()
+			t.Fatalf("Expected the other shards to be swept while one is busy, %d entries left", left)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	busy.mu.Unlock()
+
+	deadline = time.Now().Add(time.Second)
+	for remaining(busy) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the busy shard to be swept once released")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
@@ -14,6 +14,8 @@ type Cache struct {
 	indexMap       map[string]int
 	head, tail     int
 	mu             sync.Mutex
+	onEvict        EvictFunc
+	pending        []evicted // Removals waiting to be reported once the lock is released
 }
 
 type entry struct {
@@ -23,8 +25,11 @@ type entry struct {
 	prev, next int
 }
 
-func NewLRUCache(maxMemory int64, evictBatchSize int) *Cache {
-	return &Cache{
+// Option configures a Cache at construction time
+type Option func(*Cache)
+
+func NewLRUCache(maxMemory int64, evictBatchSize int, opts ...Option) *Cache {
+	c := &Cache{
 		maxMemory:      maxMemory,
 		evictBatchSize: evictBatchSize,
 		entries:        make([]entry, 0),
@@ -32,6 +37,10 @@ func NewLRUCache(maxMemory int64, evictBatchSize int) *Cache {
 		head:           -1,
 		tail:           -1,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Cache) estimateMemory(key, value []byte) int64 {
@@ -59,8 +68,9 @@ func (c *Cache) Get(key []byte, index uint8) ([]byte, uint8, bool) {
 			c.entries[idx].counter++
 		}
 		}
+		value, counter := c.entries[idx].value, c.entries[idx].counter
 		c.mu.Unlock()
-		return c.entries[idx].value, c.entries[idx].counter, true
+		return value, counter, true
 	}
 	c.mu.Unlock()
 	return nil, 0, false
@@ -69,37 +79,52 @@ func (c *Cache) Get(key []byte, index uint8) ([]byte, uint8, bool) {
 
 func (c *Cache) Set(key, value []byte) {
 	c.mu.Lock()
-	keyStr := cx.B2s(key)
-	memSize := c.estimateMemory(key, value)
+	c.set(key, value)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
 
-	for c.currentMemory+memSize > c.maxMemory && c.tail != -1 {
-		c.evict()
-	}
+	c.notifyEvicted(evicted)
+}
 
-	if c.currentMemory+memSize > c.maxMemory {
-		c.mu.Unlock()
-		return
-	}
+func (c *Cache) set(key, value []byte) {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
 
 	if idx, ok := c.indexMap[keyStr]; ok {
+		// An entry larger than the whole cache would only flush everything else before being dropped
+		if memSize > c.maxMemory {
+			c.remove(idx, EvictReplaced)
+			return
+		}
+
+		// Only the value changes, the entry keeps its hit counter and index
+		c.queueEvicted(idx, EvictReplaced)
 		oldMemSize := c.estimateMemory(c.entries[idx].key, c.entries[idx].value)
 		c.adjustMemory(memSize - oldMemSize)
 		c.entries[idx].value = value
 		c.moveToFront(idx)
-	} else {
-		c.entries = append(c.entries, entry{key: key, value: value, prev: -1, next: -1, counter: 0})
-		idx := len(c.entries) - 1
-		c.indexMap[keyStr] = idx
-		c.adjustMemory(memSize)
-		c.moveToFront(idx)
 
-		if c.head == idx {
-			if c.tail == -1 {
-				c.tail = idx
-			}
+		// A larger value may push the cache over its limit, evict from the tail one entry at a
+		// time and never the entry just updated
+		for c.currentMemory > c.maxMemory && c.tail != idx {
+			c.remove(c.tail, EvictCapacity)
 		}
+		return
 	}
-	c.mu.Unlock()
+
+	for c.currentMemory+memSize > c.maxMemory && c.tail != -1 {
+		c.evict()
+	}
+
+	if c.currentMemory+memSize > c.maxMemory {
+		return
+	}
+
+	c.entries = append(c.entries, entry{key: key, value: value, prev: -1, next: -1, counter: 0})
+	idx := len(c.entries) - 1
+	c.indexMap[keyStr] = idx
+	c.adjustMemory(memSize)
+	c.pushFront(idx)
 }
 
 func (c *Cache) moveToFront(idx int) {
@@ -129,12 +154,26 @@ func (c *Cache) Del(key []byte) {
 
 	keyStr := cx.B2s(key)
 	if idx, ok := c.indexMap[keyStr]; ok {
-		memSize := c.estimateMemory(c.entries[idx].key, c.entries[idx].value)
-		c.adjustMemory(-memSize)
-		c.detach(idx)
-		delete(c.indexMap, keyStr)
-	}	
+		c.remove(idx, EvictDeleted)
+	}
+	evicted := c.takeEvicted()
 	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+// pushFront links an entry that is not yet in the list at the head
+func (c *Cache) pushFront(idx int) {
+	c.entries[idx].prev = -1
+	c.entries[idx].next = c.head
+	if c.head != -1 {
+		c.entries[c.head].prev = idx
+	}
+	c.head = idx
+
+	if c.tail == -1 {
+		c.tail = idx
+	}
 }
 
 func (c *Cache) detach(idx int) {
@@ -158,16 +197,18 @@ func (c *Cache) detach(idx int) {
 	}
 }
 
+// remove unlinks the entry at idx and releases its memory, caller must hold the lock
+func (c *Cache) remove(idx int, reason EvictReason) {
+	memSize := c.estimateMemory(c.entries[idx].key, c.entries[idx].value)
+	c.adjustMemory(-memSize)
+	c.queueEvicted(idx, reason)
+	c.detach(idx)
+	delete(c.indexMap, cx.B2s(c.entries[idx].key))
+}
+
 func (c *Cache) evict() {
 	for i := 0; i < c.evictBatchSize && c.tail != -1; i++ {
-		oldKeyStr := cx.B2s(c.entries[c.tail].key)
-		memSize := c.estimateMemory(c.entries[c.tail].key, c.entries[c.tail].value)
-		c.adjustMemory(-memSize)
-		c.detach(c.tail)
-
-		if c.tail != -1 {
-			delete(c.indexMap, oldKeyStr)
-		}
+		c.remove(c.tail, EvictCapacity)
 
 		if c.tail == -1 {
 			break
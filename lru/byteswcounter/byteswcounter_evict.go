@@ -0,0 +1,62 @@
+package lrubyteswcounter
+
+// EvictReason tells an EvictFunc why an entry left the cache
+type EvictReason uint8
+
+const (
+	EvictCapacity EvictReason = iota // Dropped from the tail to make room for a new entry
+	EvictDeleted                     // Removed by Del
+	EvictReplaced                    // Overwritten by Set on the same key
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	}
+	return "unknown"
+}
+
+// EvictFunc is called with every entry that leaves the cache.
+//
+// It runs on the goroutine whose Set or Del caused the removal, after the cache lock has
+// been released, so it may call back into the cache. The key and value are the slices that
+// were stored, they must not be modified.
+type EvictFunc func(key, value []byte, reason EvictReason)
+
+// WithOnEvict registers fn to be told about every entry removed from the cache
+func WithOnEvict(fn EvictFunc) Option {
+	return func(c *Cache) {
+		c.onEvict = fn
+	}
+}
+
+type evicted struct {
+	key, value []byte
+	reason     EvictReason
+}
+
+// queueEvicted records the entry at idx for the callback, caller must hold the lock
+func (c *Cache) queueEvicted(idx int, reason EvictReason) {
+	if c.onEvict != nil {
+		c.pending = append(c.pending, evicted{key: c.entries[idx].key, value: c.entries[idx].value, reason: reason})
+	}
+}
+
+// takeEvicted hands over the removals queued under the lock, caller must hold the lock
+func (c *Cache) takeEvicted() []evicted {
+	pending := c.pending
+	c.pending = nil
+	return pending
+}
+
+// notifyEvicted reports removals to the callback, it must be called without holding the lock
+func (c *Cache) notifyEvicted(pending []evicted) {
+	for _, e := range pending {
+		c.onEvict(e.key, e.value, e.reason)
+	}
+}
@@ -0,0 +1,101 @@
+package lrubyteswcounter
+
+import (
+	"testing"
+)
+
+type evictRecord struct {
+	key, value string
+	reason     EvictReason
+}
+
+func TestOnEvictReasons(t *testing.T) {
+	var got []evictRecord
+	var cache *Cache
+	cache = NewLRUCache(3*2, 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		// Calling back into the cache must not deadlock
+		cache.Get(key, 0)
+		got = append(got, evictRecord{string(key), string(value), reason})
+	}))
+
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Set([]byte("d"), []byte("4")) // evicts a
+	cache.Set([]byte("b"), []byte("5")) // replaces b
+	cache.Del([]byte("c"))
+
+	want := []evictRecord{
+		{"a", "1", EvictCapacity},
+		{"b", "2", EvictReplaced},
+		{"c", "3", EvictDeleted},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d evictions, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Eviction %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+	if _, _, ok := cache.Get([]byte("a"), 0); ok {
+		t.Errorf("Expected evicted key 'a' to be gone")
+	}
+	if value, _, ok := cache.Get([]byte("b"), 0); !ok || string(value) != "5" {
+		t.Errorf("Expected key 'b' to hold the new value, got %q, %v", value, ok)
+	}
+}
+
+func TestEvictionKeepsLRUOrder(t *testing.T) {
+	cache := NewLRUCache(3*2, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Get([]byte("a"), 0)
+	cache.Set([]byte("d"), []byte("4")) // evicts b, the least recently used
+
+	if _, _, ok := cache.Get([]byte("b"), 0); ok {
+		t.Errorf("Expected 'b' to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, _, ok := cache.Get([]byte(key), 0); !ok {
+			t.Errorf("Expected %q to be present", key)
+		}
+	}
+}
+
+func TestOverwriteKeepsCounter(t *testing.T) {
+	var got []evictRecord
+	cache := NewLRUCache(3*2, 1, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		got = append(got, evictRecord{string(key), string(value), reason})
+	}))
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Get([]byte("a"), 7)
+	cache.Get([]byte("a"), 7)
+
+	cache.Set([]byte("a"), []byte("1234")) // grows by 3 bytes, evicting b
+	value, counter, ok := cache.Get([]byte("a"), 7)
+	if !ok || string(value) != "1234" || counter != 3 {
+		t.Errorf("Expected a -> 1234 with its counter kept at 3, got %q, %d, %v", value, counter, ok)
+	}
+	if _, _, ok := cache.Get([]byte("b"), 7); ok {
+		t.Errorf("Expected 'b' to be evicted to make room for the larger a")
+	}
+	want := []evictRecord{{"a", "1", EvictReplaced}, {"b", "2", EvictCapacity}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Expected evictions %v, got %v", want, got)
+	}
+}
+
+func TestOversizedOverwriteDropsEntry(t *testing.T) {
+	cache := NewLRUCache(3*2, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("a"), []byte("too large"))
+	if _, _, ok := cache.Get([]byte("a"), 0); ok {
+		t.Errorf("Expected a value larger than the cache to drop the old one")
+	}
+	if cache.currentMemory != 0 {
+		t.Errorf("Expected no memory in use, got %d", cache.currentMemory)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package cxcachelru
+
+import "iter"
+
+// All returns an iterator over the entries from most to least recently used, see Range.
+// The loop body runs without the lock held, so it may Delete the entries it visits.
+func (c *SizedCache[K, V]) All() iter.Seq2[K, V] {
+	return c.Range
+}
+
+// Backward returns an iterator over the entries from least to most recently used, see RangeReverse.
+func (c *SizedCache[K, V]) Backward() iter.Seq2[K, V] {
+	return c.RangeReverse
+}
+
+// All returns an iterator over the entries of every shard in turn, see ShardedCache.Range.
+func (sc *ShardedCache[K, V]) All() iter.Seq2[K, V] {
+	return sc.Range
+}
+
+// Backward returns an iterator walking every shard from least to most recently used.
+func (sc *ShardedCache[K, V]) Backward() iter.Seq2[K, V] {
+	return sc.RangeReverse
+}
@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package cxcachelru
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	cache := NewSizedCache[string, int](1024, 1, nil)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+
+	var forward, backward []string
+	for key := range cache.All() {
+		forward = append(forward, key)
+	}
+	for key, value := range cache.Backward() {
+		backward = append(backward, fmt.Sprint(key, value))
+		if len(backward) == 2 {
+			break
+		}
+	}
+	if fmt.Sprint(forward) != "[c b a]" || fmt.Sprint(backward) != "[a1 b2]" {
+		t.Errorf("Expected [c b a] and [a1 b2], got %v and %v", forward, backward)
+	}
+
+	// The loop body runs without the lock, so it can delete what it visits
+	for key := range cache.All() {
+		cache.Delete(key)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected Delete inside the loop to empty the cache, %d left", cache.Len())
+	}
+
+	sharded := NewShardedCache[string, int](2, 1024, 1, nil, nil)
+	sharded.Put("x", 1)
+	sharded.Put("y", 2)
+	sum := 0
+	for _, value := range sharded.All() {
+		sum += value
+	}
+	for _, value := range sharded.Backward() {
+		sum += value
+	}
+	if sum != 6 {
+		t.Errorf("Expected both sharded iterators to visit every entry, got sum %d", sum)
+	}
+}
@@ -0,0 +1,93 @@
+package cxcachelru
+
+// Range calls fn for every entry from most to least recently used until fn returns false.
+// The entries are collected under the lock and fn runs once it is released, so fn sees the
+// cache as it was when Range started and may call back into it, e.g. to Delete the entries it
+// visits.
+func (c *SizedCache[K, V]) Range(fn func(key K, value V) bool) {
+	for _, e := range c.collect(false) {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// RangeReverse is Range from least to most recently used, the order entries would be evicted in.
+func (c *SizedCache[K, V]) RangeReverse(fn func(key K, value V) bool) {
+	for _, e := range c.collect(true) {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// collect copies out the entries from head to tail, or from tail to head when reverse is set.
+func (c *SizedCache[K, V]) collect(reverse bool) []sizedEntry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]sizedEntry[K, V], 0, len(c.indexMap))
+	idx := c.head
+	if reverse {
+		idx = c.tail
+	}
+	for idx != -1 {
+		entries = append(entries, c.entries[idx])
+		if reverse {
+			idx = c.entries[idx].prev
+		} else {
+			idx = c.entries[idx].next
+		}
+	}
+	return entries
+}
+
+// Keys returns the keys from most to least recently used.
+func (c *SizedCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]K, 0, len(c.indexMap))
+	for idx := c.head; idx != -1; idx = c.entries[idx].next {
+		keys = append(keys, c.entries[idx].key)
+	}
+	return keys
+}
+
+// Range calls fn for the entries of every shard in turn until fn returns false. Each shard is
+// collected under its own lock, so the view is consistent per shard but not across shards.
+func (sc *ShardedCache[K, V]) Range(fn func(key K, value V) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.Range(func(key K, value V) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// RangeReverse is Range walking every shard from least to most recently used.
+func (sc *ShardedCache[K, V]) RangeReverse(fn func(key K, value V) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.RangeReverse(func(key K, value V) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns the keys of every shard, shard by shard.
+func (sc *ShardedCache[K, V]) Keys() []K {
+	var keys []K
+	for _, shard := range sc.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
@@ -0,0 +1,97 @@
+package cxcachelru
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRange(t *testing.T) {
+	cache := NewLRUCache[IntSizer, IntSizer](1000, 1)
+	for i := 1; i <= 4; i++ {
+		cache.Put(IntSizer(i), IntSizer(i*10))
+	}
+	cache.Get(2)
+	cache.Delete(3)
+
+	var forward, backward []IntSizer
+	cache.Range(func(key, value IntSizer) bool {
+		if value != key*10 {
+			t.Errorf("Expected %d -> %d, got %d", key, key*10, value)
+		}
+		forward = append(forward, key)
+		return true
+	})
+	cache.RangeReverse(func(key, value IntSizer) bool {
+		backward = append(backward, key)
+		return len(backward) < 2
+	})
+	if fmt.Sprint(forward) != "[2 4 1]" || fmt.Sprint(backward) != "[1 4]" {
+		t.Errorf("Expected [2 4 1] and [1 4], got %v and %v", forward, backward)
+	}
+	if keys := cache.Keys(); fmt.Sprint(keys) != "[2 4 1]" {
+		t.Errorf("Expected keys [2 4 1], got %v", keys)
+	}
+}
+
+func TestRangeDeleteWhileWalking(t *testing.T) {
+	cache := NewSizedCache[int, int](1024, 1, nil)
+	for i := 0; i < 10; i++ {
+		cache.Put(i, i)
+	}
+
+	// Selective invalidation from inside the walk must not deadlock on the cache lock
+	done := make(chan struct{})
+	go func() {
+		cache.Range(func(key, value int) bool {
+			if value%2 == 1 {
+				cache.Delete(key)
+			}
+			return true
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Delete inside Range not to block")
+	}
+	if cache.Len() != 5 {
+		t.Errorf("Expected the 5 odd entries deleted, %d left", cache.Len())
+	}
+	checkInvariants(t, cache)
+
+	sharded := NewShardedCache[int, int](4, 4096, 1, nil, nil)
+	for i := 0; i < 20; i++ {
+		sharded.Put(i, i)
+	}
+	sharded.RangeReverse(func(key, _ int) bool {
+		sharded.Delete(key)
+		return true
+	})
+	if sharded.Len() != 0 {
+		t.Errorf("Expected every entry deleted, %d left", sharded.Len())
+	}
+}
+
+func TestShardedRange(t *testing.T) {
+	cache := NewShardedCache[int, int](4, 64*1024, 1, nil, nil)
+	for i := 0; i < 100; i++ {
+		cache.Put(i, i)
+	}
+
+	keys := cache.Keys()
+	sort.Ints(keys)
+	if len(keys) != 100 || keys[0] != 0 || keys[99] != 99 {
+		t.Errorf("Expected the keys 0 to 99, got %d keys", len(keys))
+	}
+	visited := 0
+	cache.RangeReverse(func(key, value int) bool {
+		visited++
+		return visited < 30
+	})
+	if visited != 30 {
+		t.Errorf("Expected RangeReverse to stop across shards after 30 entries, visited %d", visited)
+	}
+}
@@ -0,0 +1,124 @@
+package cxcachelru
+
+import (
+	"fmt"
+	"hash/maphash"
+	"reflect"
+	"unsafe"
+)
+
+// Hasher returns the hash of a key used to pick its shard.
+type Hasher[K comparable] func(key K) uint64
+
+// ShardedCache splits entries over several SizedCaches, each with its own lock and an equal
+// share of the memory limit, so concurrent callers mostly lock different shards.
+type ShardedCache[K comparable, V any] struct {
+	shards []*SizedCache[K, V]
+	mask   uint64
+	hash   Hasher[K]
+}
+
+// NewShardedCache creates a cache of shardCount shards holding up to totalMemory bytes together.
+// A nil size falls back to EstimateSize and a nil hash to MapHasher.
+func NewShardedCache[K comparable, V any](shardCount int, totalMemory int64, evictBatchSize int, size SizeFunc[K, V], hash Hasher[K]) *ShardedCache[K, V] {
+	if shardCount <= 0 || shardCount&(shardCount-1) != 0 {
+		panic(fmt.Errorf("cxcachelru shardCount must be a power of 2, got %d", shardCount))
+	}
+	if size == nil {
+		size = EstimateSize[K, V]()
+	}
+	if hash == nil {
+		hash = MapHasher[K]()
+	}
+	shards := make([]*SizedCache[K, V], shardCount)
+	for i := range shards {
+		shards[i] = NewSizedCache(totalMemory/int64(shardCount), evictBatchSize, size)
+	}
+	return &ShardedCache[K, V]{
+		shards: shards,
+		mask:   uint64(shardCount - 1),
+		hash:   hash,
+	}
+}
+
+// NewShardedLRUCache creates a ShardedCache measuring entries by their Size methods like Cache.
+// A nil hash falls back to MapHasher, pass a Hasher for keys that are not strings or integers.
+func NewShardedLRUCache[K KeySizer, V Sizer](shardCount int, totalMemory int64, evictBatchSize int, hash Hasher[K]) *ShardedCache[K, V] {
+	return NewShardedCache(shardCount, totalMemory, evictBatchSize, estimateMemory[K, V], hash)
+}
+
+// MapHasher returns a Hasher built on hash/maphash with a random seed for keys whose underlying
+// type is a string or an integer. It panics for any other key type, pass a Hasher for those.
+func MapHasher[K comparable]() Hasher[K] {
+	seed := maphash.MakeSeed()
+	keyType := reflect.TypeFor[K]()
+	switch keyType.Kind() {
+	case reflect.String:
+		return func(key K) uint64 {
+			return maphash.String(seed, *(*string)(unsafe.Pointer(&key)))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		size := keyType.Size()
+		return func(key K) uint64 {
+			return maphash.Bytes(seed, unsafe.Slice((*byte)(unsafe.Pointer(&key)), size))
+		}
+	}
+	panic(fmt.Errorf("cxcachelru no default hasher for %v keys", keyType))
+}
+
+// shard returns the shard owning key.
+func (sc *ShardedCache[K, V]) shard(key K) *SizedCache[K, V] {
+	return sc.shards[sc.hash(key)&sc.mask]
+}
+
+// Get retrieves the value for a key from its shard.
+func (sc *ShardedCache[K, V]) Get(key K) (V, bool) {
+	return sc.shard(key).Get(key)
+}
+
+// Put adds or replaces a key-value pair in its shard.
+func (sc *ShardedCache[K, V]) Put(key K, value V) {
+	sc.shard(key).Put(key, value)
+}
+
+// Delete removes a key from its shard.
+func (sc *ShardedCache[K, V]) Delete(key K) {
+	sc.shard(key).Delete(key)
+}
+
+// Len returns the number of entries in all shards, locking one shard at a time.
+func (sc *ShardedCache[K, V]) Len() int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Stats returns the counters and memory usage summed over all shards.
+func (sc *ShardedCache[K, V]) Stats() Stats {
+	var total Stats
+	for _, shard := range sc.shards {
+		s := shard.Stats()
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+		total.Sets += s.Sets
+		total.Deletes += s.Deletes
+		total.Evictions += s.Evictions
+		total.Rejected += s.Rejected
+		total.Bytes += s.Bytes
+		total.MaxBytes += s.MaxBytes
+		total.Items += s.Items
+	}
+	return total
+}
+
+// ShardStats returns the counters of every shard, indexed by shard number.
+func (sc *ShardedCache[K, V]) ShardStats() []Stats {
+	stats := make([]Stats, len(sc.shards))
+	for i, shard := range sc.shards {
+		stats[i] = shard.Stats()
+	}
+	return stats
+}
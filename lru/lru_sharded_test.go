@@ -0,0 +1,198 @@
+package cxcachelru
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	cache := NewShardedCache[string, user](8, 64*1024, 1, userSize, nil)
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("user%d", i)
+		cache.Put(key, user{ID: int64(i), Name: key})
+	}
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("user%d", i)
+		if u, ok := cache.Get(key); !ok || u.ID != int64(i) {
+			t.Fatalf("Expected %s, got %+v, %v", key, u, ok)
+		}
+	}
+	cache.Delete("user7")
+	if _, ok := cache.Get("user7"); ok {
+		t.Errorf("Expected user7 to be deleted")
+	}
+	if cache.Len() != 499 {
+		t.Errorf("Expected 499 entries, got %d", cache.Len())
+	}
+
+	stats := cache.Stats()
+	if stats.Items != 499 || stats.Hits != 500 || stats.Misses != 1 || stats.MaxBytes != 64*1024 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	for i, s := range cache.ShardStats() {
+		if s.Items == 0 {
+			t.Errorf("Shard %d holds no entries, keys are not spread", i)
+		}
+	}
+}
+
+func TestShardedCacheMemoryPerShard(t *testing.T) {
+	cache := NewShardedCache[int, int](4, 4*10*16, 1, nil, nil)
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i)
+	}
+	for i, s := range cache.ShardStats() {
+		if s.MaxBytes != 160 || s.Bytes > s.MaxBytes {
+			t.Errorf("Shard %d uses %d of %d bytes", i, s.Bytes, s.MaxBytes)
+		}
+	}
+	if cache.Len() > 40 {
+		t.Errorf("Expected at most 40 entries, got %d", cache.Len())
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func TestShardedLRUCache(t *testing.T) {
+	cache := NewShardedLRUCache[IntSizer, IntSizer](2, 1000, 1, nil)
+	cache.Put(1, 10)
+	if v, ok := cache.Get(1); !ok || v != 10 {
+		t.Errorf("Expected 1 -> 10, got %d, %v", v, ok)
+	}
+	if stats := cache.Stats(); stats.Bytes != 16 {
+		t.Errorf("Expected 16 bytes, got %d", stats.Bytes)
+	}
+}
+
+type tileKey struct{ x, y int32 }
+
+func (k tileKey) Size() int64 { return 8 }
+
+func TestShardedLRUCacheStructKey(t *testing.T) {
+	cache := NewShardedLRUCache[tileKey, IntSizer](4, 1000, 1, func(k tileKey) uint64 {
+		return uint64(k.x)
+	})
+	for x := int32(0); x < 4; x++ {
+		cache.Put(tileKey{x, -x}, IntSizer(x))
+	}
+	if v, ok := cache.Get(tileKey{2, -2}); !ok || v != 2 {
+		t.Errorf("Expected {2 -2} -> 2, got %d, %v", v, ok)
+	}
+	for i, shard := range cache.shards {
+		if shard.Len() != 1 {
+			t.Errorf("Expected shard %d to hold 1 entry, got %d", i, shard.Len())
+		}
+	}
+	if stats := cache.Stats(); stats.Bytes != 4*16 {
+		t.Errorf("Expected 64 bytes, got %d", stats.Bytes)
+	}
+}
+
+func TestShardedCacheCustomHasher(t *testing.T) {
+	type point struct{ x, y int }
+	cache := NewShardedCache[point, string](4, 1024, 1, nil, func(p point) uint64 {
+		return uint64(p.x)
+	})
+	for x := 0; x < 4; x++ {
+		cache.Put(point{x, x}, strconv.Itoa(x))
+	}
+	for i, shard := range cache.shards {
+		if shard.Len() != 1 {
+			t.Errorf("Expected shard %d to hold 1 entry, got %d", i, shard.Len())
+		}
+	}
+}
+
+func TestMapHasher(t *testing.T) {
+	type id string
+	hash := MapHasher[id]()
+	if hash("a") != hash(id("a")) || hash("a") == hash("b") {
+		t.Errorf("Expected equal strings to hash equally and different ones not to")
+	}
+	hashInt := MapHasher[IntSizer]()
+	if hashInt(1) != hashInt(1) || hashInt(1) == hashInt(2) {
+		t.Errorf("Expected equal integers to hash equally and different ones not to")
+	}
+	if n := testing.AllocsPerRun(100, func() { hash("key"); hashInt(42) }); n != 0 {
+		t.Errorf("Expected hashing not to allocate, got %v allocs", n)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for keys without a default hasher")
+		}
+	}()
+	MapHasher[struct{ a, b int }]()
+}
+
+func TestShardedCacheConcurrent(t *testing.T) {
+	cache := NewShardedCache[string, user](16, 64*1024, 1, userSize, nil)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("user%d", (g*2000+i)%700)
+				cache.Put(key, user{ID: int64(i), Name: key})
+				if u, ok := cache.Get(key); ok && u.Name != key {
+					t.Errorf("Expected %s, got %+v", key, u)
+					return
+				}
+				if i%10 == 0 {
+					cache.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func benchmarkKeys() []string {
+	keys := make([]string, 1<<14)
+	for i := range keys {
+		keys[i] = "user" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// BenchmarkParallelSizedCache measures a single lock shared by all goroutines
+func BenchmarkParallelSizedCache(b *testing.B) {
+	keys := benchmarkKeys()
+	cache := NewSizedCache[string, user](16*1024*1024, 1, userSize)
+	benchmarkParallel(b, keys, cache.Get, cache.Put)
+}
+
+// BenchmarkParallelShardedCache measures the same workload spread over 64 shards
+func BenchmarkParallelShardedCache(b *testing.B) {
+	keys := benchmarkKeys()
+	cache := NewShardedCache[string, user](64, 16*1024*1024, 1, userSize, nil)
+	benchmarkParallel(b, keys, cache.Get, cache.Put)
+}
+
+// benchmarkParallel runs 9 Gets for every Put from all goroutines
+func benchmarkParallel(b *testing.B, keys []string, get func(string) (user, bool), put func(string, user)) {
+	for _, key := range keys {
+		put(key, user{Name: key})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i&(len(keys)-1)]
+			if i%10 == 0 {
+				put(key, user{Name: key})
+			} else {
+				get(key)
+			}
+			i += 7
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package cxcachelru
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// SizeFunc returns the memory in bytes taken by an entry.
+type SizeFunc[K comparable, V any] func(key K, value V) int64
+
+// SizedCache is a memory bounded LRU cache for any comparable key and any value, sized by a
+// SizeFunc instead of requiring the types to implement Sizer. The size of every entry is taken
+// once when it is stored, so overwriting a key with a larger or smaller value is accounted for
+// exactly, evicting other entries if the cache grew past its limit.
+type SizedCache[K comparable, V any] struct {
+	maxMemory      int64
+	currentMemory  int64
+	evictBatchSize int
+	entries        []sizedEntry[K, V]
+	freeEntries    []int // Stack of indices of free entries
+	indexMap       map[K]int
+	head, tail     int
+	size           SizeFunc[K, V]
+	mu             sync.Mutex
+	stats          counters // Guarded by mu like everything else
+}
+
+type sizedEntry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64 // As measured when the entry was stored
+	prev  int
+	next  int
+}
+
+// NewSizedCache creates a cache holding up to maxMemory bytes of entries as measured by size.
+// A nil size falls back to EstimateSize.
+func NewSizedCache[K comparable, V any](maxMemory int64, evictBatchSize int, size SizeFunc[K, V]) *SizedCache[K, V] {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	if size == nil {
+		size = EstimateSize[K, V]()
+	}
+	return &SizedCache[K, V]{
+		maxMemory:      maxMemory,
+		evictBatchSize: evictBatchSize,
+		indexMap:       make(map[K]int),
+		head:           -1,
+		tail:           -1,
+		size:           size,
+	}
+}
+
+// EstimateSize returns a SizeFunc that adds up an estimate of the key and the value. Types
+// implementing Sizer report their own size, strings and byte slices (named ones included) count
+// their length and anything else counts its fixed in-memory size, which does not include what
+// pointers, slices, maps or strings inside it refer to. Pass a SizeFunc for such types.
+// Interface types are measured by the dynamic type of each value the same way.
+func EstimateSize[K comparable, V any]() SizeFunc[K, V] {
+	keySize, valueSize := estimator[K](), estimator[V]()
+	return func(key K, value V) int64 {
+		return keySize(key) + valueSize(value)
+	}
+}
+
+var sizerType = reflect.TypeFor[Sizer]()
+
+// estimator picks how to size a T once from its kind, so sizing an entry needs no reflection
+// unless T is an interface type
+func estimator[T any]() func(T) int64 {
+	t := reflect.TypeFor[T]()
+	switch {
+	case t.Implements(sizerType):
+		return func(v T) int64 {
+			if s, ok := any(v).(Sizer); ok {
+				return s.Size()
+			}
+			return 0 // A nil interface
+		}
+	case t.Kind() == reflect.String:
+		return func(v T) int64 { return int64(len(*(*string)(unsafe.Pointer(&v)))) }
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return func(v T) int64 { return int64(len(*(*[]byte)(unsafe.Pointer(&v)))) }
+	case t.Kind() == reflect.Interface:
+		return func(v T) int64 { return dynamicSize(any(v)) }
+	}
+	size := int64(t.Size())
+	return func(T) int64 { return size }
+}
+
+// dynamicSize measures a value held in an interface like estimator measures static types
+func dynamicSize(v any) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return v.Size()
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String || (rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8) {
+		return int64(rv.Len())
+	}
+	return int64(rv.Type().Size())
+}
+
+// Get retrieves the value for a key from the cache.
+func (c *SizedCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx, ok := c.indexMap[key]; ok {
+		if idx != c.head {
+			c.moveToFront(idx)
+		}
+		c.stats.hits++
+		return c.entries[idx].value, true
+	}
+	c.stats.misses++
+	var zero V
+	return zero, false
+}
+
+// Put adds or replaces a key-value pair, evicting the least recently used entries as necessary.
+// An entry larger than the whole cache is not stored and drops the old value of the key.
+func (c *SizedCache[K, V]) Put(key K, value V) {
+	memSize := c.size(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx, exists := c.indexMap[key]
+	if memSize > c.maxMemory {
+		if exists {
+			c.remove(idx)
+		}
+		c.stats.rejected++
+		return
+	}
+
+	if exists {
+		c.adjustMemory(memSize - c.entries[idx].size)
+		c.entries[idx].value = value
+		c.entries[idx].size = memSize
+		c.moveToFront(idx)
+
+		// A value that grew may push the cache over its limit. The entry just put is at the head
+		// and fits on its own, so evict one entry at a time and stop before reaching it rather
+		// than a whole batch that could take it along
+		for c.currentMemory > c.maxMemory && c.tail != idx {
+			c.remove(c.tail)
+			c.stats.evictions++
+		}
+	} else {
+		for c.currentMemory+memSize > c.maxMemory && c.tail != -1 {
+			c.evict()
+		}
+		idx = c.alloc()
+		c.entries[idx] = sizedEntry[K, V]{key: key, value: value, size: memSize, prev: -1, next: -1}
+		c.indexMap[key] = idx
+		c.adjustMemory(memSize)
+		c.pushFront(idx)
+	}
+	c.stats.sets++
+}
+
+// alloc returns a free slot, reusing deleted ones first.
+func (c *SizedCache[K, V]) alloc() int {
+	if n := len(c.freeEntries); n > 0 {
+		idx := c.freeEntries[n-1]
+		c.freeEntries = c.freeEntries[:n-1]
+		return idx
+	}
+	c.entries = append(c.entries, sizedEntry[K, V]{})
+	return len(c.entries) - 1
+}
+
+// Delete removes a key from the cache.
+func (c *SizedCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx, ok := c.indexMap[key]; ok {
+		c.remove(idx)
+		c.stats.deletes++
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *SizedCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.indexMap)
+}
+
+// remove unlinks the entry at idx and frees its slot, caller must hold the lock.
+func (c *SizedCache[K, V]) remove(idx int) {
+	c.adjustMemory(-c.entries[idx].size)
+	c.detach(idx)
+	delete(c.indexMap, c.entries[idx].key)
+	c.entries[idx] = sizedEntry[K, V]{prev: -1, next: -1} // Let go of what the key and value refer to
+	c.freeEntries = append(c.freeEntries, idx)
+}
+
+// evict removes the least recently used items based on the eviction batch size.
+func (c *SizedCache[K, V]) evict() {
+	for i := 0; i < c.evictBatchSize && c.tail != -1; i++ {
+		c.remove(c.tail)
+		c.stats.evictions++
+	}
+}
+
+// pushFront links an entry that is not yet in the list at the head.
+func (c *SizedCache[K, V]) pushFront(idx int) {
+	c.entries[idx].prev = -1
+	c.entries[idx].next = c.head
+	if c.head != -1 {
+		c.entries[c.head].prev = idx
+	}
+	c.head = idx
+
+	if c.tail == -1 {
+		c.tail = idx
+	}
+}
+
+// moveToFront makes the entry at idx the most recently used.
+func (c *SizedCache[K, V]) moveToFront(idx int) {
+	if idx == c.head {
+		return
+	}
+	c.detach(idx)
+	c.pushFront(idx)
+}
+
+// detach removes an entry from the linked list part of the cache.
+func (c *SizedCache[K, V]) detach(idx int) {
+	if c.entries[idx].prev != -1 {
+		c.entries[c.entries[idx].prev].next = c.entries[idx].next
+	} else {
+		c.head = c.entries[idx].next
+	}
+
+	if c.entries[idx].next != -1 {
+		c.entries[c.entries[idx].next].prev = c.entries[idx].prev
+	} else {
+		c.tail = c.entries[idx].prev
+	}
+
+	c.entries[idx].prev = -1
+	c.entries[idx].next = -1
+}
+
+// adjustMemory modifies the current memory tracking.
+func (c *SizedCache[K, V]) adjustMemory(delta int64) {
+	c.currentMemory += delta
+}
@@ -0,0 +1,302 @@
+package cxcachelru
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type user struct {
+	ID    int64
+	Name  string
+	Admin bool
+}
+
+func userSize(key string, value user) int64 {
+	return int64(len(key) + len(value.Name) + 16)
+}
+
+// checkInvariants verifies the list, the index, the free slots and the memory accounting agree
+func checkInvariants[K comparable, V any](t *testing.T, c *SizedCache[K, V]) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var memory int64
+	linked := 0
+	prev := -1
+	for idx := c.head; idx != -1; idx = c.entries[idx].next {
+		e := c.entries[idx]
+		if e.prev != prev {
+			t.Fatalf("Entry %d links back to %d, expected %d", idx, e.prev, prev)
+		}
+		if got, ok := c.indexMap[e.key]; !ok || got != idx {
+			t.Fatalf("Index of %v does not point at %d", e.key, idx)
+		}
+		if e.size != c.size(e.key, e.value) {
+			t.Fatalf("Entry %v is accounted as %d bytes, measures %d", e.key, e.size, c.size(e.key, e.value))
+		}
+		memory += e.size
+		linked++
+		prev = idx
+	}
+	if prev != c.tail {
+		t.Fatalf("List ends at %d, tail is %d", prev, c.tail)
+	}
+	if linked != len(c.indexMap) || linked+len(c.freeEntries) != len(c.entries) {
+		t.Fatalf("%d linked, %d indexed, %d free of %d slots", linked, len(c.indexMap), len(c.freeEntries), len(c.entries))
+	}
+	if memory != c.currentMemory || memory > c.maxMemory {
+		t.Fatalf("Entries hold %d bytes, currentMemory %d, maxMemory %d", memory, c.currentMemory, c.maxMemory)
+	}
+}
+
+func TestSizedCacheStructValues(t *testing.T) {
+	cache := NewSizedCache[string, user](1024, 1, userSize)
+	cache.Put("alice", user{ID: 1, Name: "Alice"})
+	cache.Put("bob", user{ID: 2, Name: "Bob", Admin: true})
+
+	if u, ok := cache.Get("bob"); !ok || u.Name != "Bob" || !u.Admin {
+		t.Errorf("Expected bob, got %+v, %v", u, ok)
+	}
+	cache.Delete("bob")
+	if _, ok := cache.Get("bob"); ok {
+		t.Errorf("Expected bob to be deleted")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 entry, got %d", cache.Len())
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSizedCacheOverwriteAccounting(t *testing.T) {
+	cache := NewSizedCache[string, string](100, 1, nil)
+	cache.Put("a", "0123456789")
+	cache.Put("b", "0123456789")
+	cache.Put("c", "0123456789")
+	if got := cache.Stats().Bytes; got != 33 {
+		t.Fatalf("Expected 33 bytes, got %d", got)
+	}
+
+	// Shrinking frees memory
+	cache.Put("a", "0")
+	if got := cache.Stats().Bytes; got != 24 {
+		t.Errorf("Expected 24 bytes after shrinking a, got %d", got)
+	}
+
+	// Growing past the limit evicts the least recently used entries, never the one just put
+	cache.Put("c", string(make([]byte, 90)))
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected b to be evicted to make room for the larger c")
+	}
+	if v, ok := cache.Get("c"); !ok || len(v) != 90 {
+		t.Errorf("Expected c to hold the larger value")
+	}
+	checkInvariants(t, cache)
+
+	// A value larger than the whole cache drops the old one
+	cache.Put("c", string(make([]byte, 200)))
+	if _, ok := cache.Get("c"); ok {
+		t.Errorf("Expected c to be dropped by a value larger than the cache")
+	}
+	if stats := cache.Stats(); stats.Rejected != 1 {
+		t.Errorf("Expected 1 rejected Put, got %d", stats.Rejected)
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSizedCacheOverwriteBatchEviction(t *testing.T) {
+	cache := NewSizedCache[string, string](20, 4, nil)
+	cache.Put("a", "xxxx")
+	cache.Put("b", "xxxx")
+	cache.Put("c", "xxxx")
+
+	// Growing a to 16 bytes needs both other entries gone, a batch of 4 must not take a along
+	cache.Put("a", "012345678901234")
+	if v, ok := cache.Get("a"); !ok || v != "012345678901234" {
+		t.Errorf("Expected a to hold the larger value, got %q, %v", v, ok)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected only a to be left, got %d entries", cache.Len())
+	}
+	if stats := cache.Stats(); stats.Evictions != 2 || stats.Bytes != 16 {
+		t.Errorf("Expected 2 evictions and 16 bytes, got %+v", stats)
+	}
+	checkInvariants(t, cache)
+
+	// Shrinking back leaves room for the others without evicting anything
+	cache.Put("a", "x")
+	cache.Put("b", "xxxx")
+	cache.Put("c", "xxxx")
+	if cache.Len() != 3 || cache.Stats().Evictions != 2 {
+		t.Errorf("Expected 3 entries and no new evictions, got %d entries and %+v", cache.Len(), cache.Stats())
+	}
+	checkInvariants(t, cache)
+}
+
+type sizedValue struct{ n int64 }
+
+func (v sizedValue) Size() int64 { return v.n }
+
+func TestEstimateSize(t *testing.T) {
+	if got := EstimateSize[string, []byte]()("abc", make([]byte, 10)); got != 13 {
+		t.Errorf("Expected string and []byte to count their length, got %d", got)
+	}
+	if got := EstimateSize[int32, float64]()(1, 2); got != 12 {
+		t.Errorf("Expected fixed size types to count their size, got %d", got)
+	}
+	if got := EstimateSize[int64, sizedValue]()(1, sizedValue{100}); got != 108 {
+		t.Errorf("Expected a Sizer to report its own size, got %d", got)
+	}
+	if got := EstimateSize[[16]byte, struct{ a, b int64 }]()([16]byte{}, struct{ a, b int64 }{}); got != 32 {
+		t.Errorf("Expected arrays and structs to count their size, got %d", got)
+	}
+}
+
+type (
+	userID string
+	blob   []byte
+)
+
+func TestEstimateSizeNamedTypes(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	if got, want := EstimateSize[userID, blob]()(userID(long), make(blob, 10)), EstimateSize[string, []byte]()(long, make([]byte, 10)); got != want || got != 1010 {
+		t.Errorf("Expected named types to count their length like string and []byte, got %d and %d", got, want)
+	}
+
+	size := EstimateSize[string, any]()
+	for _, tc := range []struct {
+		value any
+		want  int64
+	}{
+		{nil, 1},
+		{"abcd", 5},
+		{[]byte("abcd"), 5},
+		{userID(long), 1001},
+		{blob("abcd"), 5},
+		{sizedValue{100}, 101},
+		{int64(1), 9},
+	} {
+		if got := size("k", tc.value); got != tc.want {
+			t.Errorf("Expected %T to measure %d bytes, got %d", tc.value, tc.want, got)
+		}
+	}
+
+	var sizer Sizer = sizedValue{40}
+	if got := EstimateSize[int64, Sizer]()(1, sizer); got != 48 {
+		t.Errorf("Expected a Sizer interface to report the dynamic size, got %d", got)
+	}
+	if got := EstimateSize[int64, Sizer]()(1, nil); got != 8 {
+		t.Errorf("Expected a nil Sizer to count nothing, got %d", got)
+	}
+
+	cache := NewSizedCache[userID, string](2000, 1, nil)
+	cache.Put(userID(long), "v")
+	if got := cache.Stats().Bytes; got != 1001 {
+		t.Errorf("Expected the cache to account 1001 bytes for a long named key, got %d", got)
+	}
+}
+
+func TestSizedCacheEviction(t *testing.T) {
+	cache := NewSizedCache[int, int](3*16, 1, nil)
+	for i := 0; i < 5; i++ {
+		cache.Put(i, i)
+	}
+	cache.Get(2)
+	cache.Put(5, 5)
+
+	for i, want := range []bool{false, false, true, false, true, true} {
+		if _, ok := cache.Get(i); ok != want {
+			t.Errorf("Expected %d cached: %v, got %v", i, want, ok)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 3 {
+		t.Errorf("Expected 3 evictions, got %d", stats.Evictions)
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSizedCacheRandomOperations(t *testing.T) {
+	cache := NewSizedCache[string, []byte](4096, 4, nil)
+	rng := rand.New(rand.NewSource(8))
+	for i := 0; i < 50000; i++ {
+		key := fmt.Sprintf("key%d", rng.Intn(500))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Delete(key)
+		case 1:
+			cache.Put(key, make([]byte, rng.Intn(128)))
+		default:
+			cache.Get(key)
+		}
+		if i%1000 == 0 {
+			checkInvariants(t, cache)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSizedCacheConcurrent(t *testing.T) {
+	cache := NewSizedCache[string, user](64*1024, 1, userSize)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("user%d", (g*2000+i)%700)
+				cache.Put(key, user{ID: int64(i), Name: key})
+				if u, ok := cache.Get(key); ok && u.Name != key {
+					t.Errorf("Expected %s, got %+v", key, u)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	checkInvariants(t, cache)
+}
+
+func TestCacheOverwriteGrowsWithinLimit(t *testing.T) {
+	cache := NewLRUCache[IntSizer, sizedValue](100, 1)
+	cache.Put(1, sizedValue{40})
+	cache.Put(2, sizedValue{40})
+	cache.Put(1, sizedValue{80})
+
+	if _, ok := cache.Get(2); ok {
+		t.Errorf("Expected 2 to be evicted when 1 grew")
+	}
+	if stats := cache.Stats(); stats.Bytes != 88 {
+		t.Errorf("Expected 88 bytes, got %d", stats.Bytes)
+	}
+	checkInvariants(t, cache.SizedCache)
+}
+
+func BenchmarkSizedCachePut(b *testing.B) {
+	cache := NewSizedCache[string, user](1024*1024, 1, userSize)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%d", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Put(keys[i%10000], user{ID: int64(i), Name: "name"})
+	}
+}
+
+func BenchmarkSizedCacheGet(b *testing.B) {
+	cache := NewSizedCache[string, user](1024*1024, 1, nil)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%d", i)
+		cache.Put(keys[i], user{ID: int64(i)})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(keys[i%10000])
+	}
+}
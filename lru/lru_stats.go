@@ -0,0 +1,46 @@
+package cxcachelru
+
+// Stats is a point in time view of a cache's counters and memory usage.
+type Stats struct {
+	Hits      uint64 // Get calls that found an entry
+	Misses    uint64 // Get calls that found nothing
+	Sets      uint64 // Entries stored or updated by Put
+	Deletes   uint64 // Entries removed by Delete
+	Evictions uint64 // Entries dropped to make room for new ones
+	Rejected  uint64 // Puts dropped because the entry alone exceeds the memory limit
+	Bytes     int64  // Estimated memory currently in use
+	MaxBytes  int64  // Memory limit
+	Items     int    // Number of entries currently stored
+}
+
+// HitRatio returns hits / (hits + misses), or 0 before the first Get.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// counters are plain integers since every SizedCache method already holds the lock.
+type counters struct {
+	hits, misses, sets, deletes, evictions, rejected uint64
+}
+
+// Stats returns the cache's counters and current memory usage.
+func (c *SizedCache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.stats.hits,
+		Misses:    c.stats.misses,
+		Sets:      c.stats.sets,
+		Deletes:   c.stats.deletes,
+		Evictions: c.stats.evictions,
+		Rejected:  c.stats.rejected,
+		Bytes:     c.currentMemory,
+		MaxBytes:  c.maxMemory,
+		Items:     len(c.indexMap),
+	}
+}
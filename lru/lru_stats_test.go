@@ -0,0 +1,36 @@
+package cxcachelru
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	cache := NewLRUCache[IntSizer, IntSizer](32, 1) // room for two entries of 16 bytes
+
+	cache.Put(1, 10)
+	cache.Put(2, 20)
+	cache.Put(2, 21)
+	cache.Put(3, 30) // evicts 1
+	cache.Get(1)
+	cache.Get(2)
+	cache.Get(3)
+	cache.Delete(2)
+	cache.Delete(2)
+
+	want := Stats{
+		Hits:      2,
+		Misses:    1,
+		Sets:      4,
+		Deletes:   1,
+		Evictions: 1,
+		Bytes:     16,
+		MaxBytes:  32,
+		Items:     1,
+	}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Expected stats %+v, got %+v", want, got)
+	}
+	if v, ok := cache.Get(3); !ok || v != 30 {
+		t.Errorf("Expected 3 -> 30, got %v, %v", v, ok)
+	}
+}
@@ -1,6 +1,7 @@
 package lruxbytes
 
 import (
+	"bytes"
 	"sync"
 )
 
@@ -12,27 +13,41 @@ type Cache struct {
 	currentMemory  int64
 	evictBatchSize int
 	entries        []entry
-	indexMap       map[uint32]uint32 // Change to uint32 for index
+	indexMap       map[uint64]uint32 // Hash to slot, the head of the slot chain in verified mode
+	items          int
 	head, tail     int
-	hashFunc       ByteHashFunc // User-defined hash function
+	hashFunc       ByteHashFunc   // User-defined hash function
+	hashFunc64     ByteHashFunc64 // Used instead of hashFunc when set
+	verified       bool           // Compare keys and chain colliding ones instead of trusting the hash
 	mu             sync.Mutex
+	onEvict        EvictFunc
+	pending        []evicted // Removals waiting to be reported once the lock is released
+	stats          counters  // Guarded by mu like everything else
 }
 
 type entry struct {
 	key, value []byte
 	prev, next int
+	chain      int // Next slot with the same hash in verified mode, -1 ends the chain
 }
 
-func NewLRUCache(maxMemory int64, evictBatchSize int, hashFunc func([]byte) uint32) *Cache {
-	return &Cache{
+// Option configures a Cache at construction time
+type Option func(*Cache)
+
+func NewLRUCache(maxMemory int64, evictBatchSize int, hashFunc func([]byte) uint32, opts ...Option) *Cache {
+	c := &Cache{
 		maxMemory:      maxMemory,
 		evictBatchSize: evictBatchSize,
 		entries:        make([]entry, 0),
-		indexMap:       make(map[uint32]uint32), // Adjusted to uint32
+		indexMap:       make(map[uint64]uint32),
 		head:           -1,
 		tail:           -1,
 		hashFunc:       hashFunc, // Assign the user-defined hash function
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Cache) estimateMemory(key, value []byte) int64 {
@@ -43,33 +58,62 @@ func (c *Cache) adjustMemory(delta int64) {
 	c.currentMemory += delta
 }
 
-func (c *Cache) hashKey(key []byte) uint32 {
-	return c.hashFunc(key) // Use the user-defined hash function
+func (c *Cache) hashKey(key []byte) uint64 {
+	if c.hashFunc64 != nil {
+		return c.hashFunc64(key)
+	}
+	return uint64(c.hashFunc(key)) // Use the user-defined hash function
 }
 
 func (c *Cache) Get(key []byte) ([]byte, bool) {
 	c.mu.Lock()
-	keyHash := c.hashKey(key)
-	if idx, ok := c.indexMap[keyHash]; ok {
-		if int(idx) != c.head { // Cast idx to int for comparison
-			c.moveToFront(int(idx))
+	if idx, ok := c.lookup(key); ok {
+		if idx != c.head {
+			c.moveToFront(idx)
 		}
+		value := c.entries[idx].value
+		c.stats.hits++
 		c.mu.Unlock()
-		return c.entries[idx].value, true
+		return value, true
 	}
+	c.stats.misses++
 	c.mu.Unlock()
 	return nil, false
 }
 
 func (c *Cache) Set(key, value []byte) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.set(key, value)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
 
+	c.notifyEvicted(evicted)
+}
+
+func (c *Cache) set(key, value []byte) {
 	keyHash := c.hashKey(key)
 	memSize := c.estimateMemory(key, value)
 
+	// Unlink the old entry first so its memory is released before making room, its slot is reused below
+	slot := -1
+	if idx, ok := c.lookup(key); ok {
+		slot = idx
+		if !c.verified && !bytes.Equal(c.entries[idx].key, key) {
+			c.stats.collisions++ // Another key with the same hash, overwritten without verification
+		}
+		c.remove(slot, EvictReplaced)
+	} else if _, ok := c.indexMap[keyHash]; ok {
+		c.stats.collisions++ // Another key with the same hash, chained next to it
+	}
+
+	// An entry larger than the whole cache would only flush everything else before being dropped
+	if memSize > c.maxMemory {
+		c.stats.rejected++
+		return
+	}
+
 	// Evict until the cache size is within the maximum limit
-	for c.currentMemory+memSize > c.maxMemory {
+	for c.currentMemory+memSize > c.maxMemory && c.tail != -1 {
 		c.evict()
 	}
 
@@ -79,37 +123,26 @@ func (c *Cache) Set(key, value []byte) {
 	}
 
 	// Add the new entry
-	if idx, ok := c.indexMap[keyHash]; ok {
-		oldMemSize := c.estimateMemory(c.entries[int(idx)].key, c.entries[int(idx)].value)
-		c.adjustMemory(memSize - oldMemSize)
-		c.entries[idx].value = value
-		c.moveToFront(int(idx))
-	} else {
-		c.entries = append(c.entries, entry{key: key, value: value, prev: -1, next: -1})
-		idx := uint32(len(c.entries) - 1)
-		c.indexMap[keyHash] = idx
-		c.adjustMemory(memSize)
-		c.moveToFront(int(idx))
-
-		if c.head == int(idx) {
-			if c.tail == -1 {
-				c.tail = int(idx)
-			}
-		}
+	if slot == -1 {
+		c.entries = append(c.entries, entry{})
+		slot = len(c.entries) - 1
 	}
+	c.entries[slot] = entry{key: key, value: value, prev: -1, next: -1, chain: -1}
+	c.link(slot, keyHash)
+	c.adjustMemory(memSize)
+	c.pushFront(slot)
+	c.stats.sets++
 }
 
-
 func (c *Cache) Del(key []byte) {
 	c.mu.Lock()
-	keyHash := c.hashKey(key)
-	if idx, ok := c.indexMap[keyHash]; ok {
-		memSize := c.estimateMemory(c.entries[int(idx)].key, c.entries[int(idx)].value)
-		c.adjustMemory(-memSize)
-		c.detach(int(idx))
-		delete(c.indexMap, keyHash)
+	if idx, ok := c.lookup(key); ok {
+		c.remove(idx, EvictDeleted)
 	}
+	evicted := c.takeEvicted()
 	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
 }
 
 func (c *Cache) moveToFront(idx int) {
@@ -134,6 +167,20 @@ func (c *Cache) moveToFront(idx int) {
 	}
 }
 
+// pushFront links an entry that is not yet in the list at the head
+func (c *Cache) pushFront(idx int) {
+	c.entries[idx].prev = -1
+	c.entries[idx].next = c.head
+	if c.head != -1 {
+		c.entries[c.head].prev = idx
+	}
+	c.head = idx
+
+	if c.tail == -1 {
+		c.tail = idx
+	}
+}
+
 func (c *Cache) detach(idx int) {
 	if c.entries[idx].prev != -1 {
 		c.entries[c.entries[idx].prev].next = c.entries[idx].next
@@ -155,16 +202,19 @@ func (c *Cache) detach(idx int) {
 	}
 }
 
+// remove unlinks the entry at idx and releases its memory, caller must hold the lock
+func (c *Cache) remove(idx int, reason EvictReason) {
+	memSize := c.estimateMemory(c.entries[idx].key, c.entries[idx].value)
+	c.adjustMemory(-memSize)
+	c.queueEvicted(idx, reason)
+	c.stats.record(reason)
+	c.detach(idx)
+	c.unlink(idx)
+}
+
 func (c *Cache) evict() {
 	for i := 0; i < c.evictBatchSize && c.tail != -1; i++ {
-		oldKeyHash := c.hashKey(c.entries[c.tail].key)
-		memSize := c.estimateMemory(c.entries[c.tail].key, c.entries[c.tail].value)
-		c.adjustMemory(-memSize)
-		c.detach(c.tail)
-
-		if c.tail != -1 {
-			delete(c.indexMap, oldKeyHash)
-		}
+		c.remove(c.tail, EvictCapacity)
 
 		if c.tail == -1 {
 			break
@@ -0,0 +1,65 @@
+package lruxbytes
+
+import (
+	"testing"
+)
+
+type evictRecord struct {
+	key, value string
+	reason     EvictReason
+}
+
+func TestOnEvictReasons(t *testing.T) {
+	var got []evictRecord
+	var cache *Cache
+	cache = NewLRUCache(3*(1+4), 1, FNV1aHash, WithOnEvict(func(key, value []byte, reason EvictReason) {
+		// Calling back into the cache must not deadlock
+		cache.Get(key)
+		got = append(got, evictRecord{string(key), string(value), reason})
+	}))
+
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Set([]byte("d"), []byte("4")) // evicts a
+	cache.Set([]byte("b"), []byte("5")) // replaces b
+	cache.Del([]byte("c"))
+
+	want := []evictRecord{
+		{"a", "1", EvictCapacity},
+		{"b", "2", EvictReplaced},
+		{"c", "3", EvictDeleted},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d evictions, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Eviction %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected evicted key 'a' to be gone")
+	}
+	if _, ok := cache.Get([]byte("d")); !ok {
+		t.Errorf("Expected key 'd' to be present")
+	}
+}
+
+func TestEvictionKeepsLRUOrder(t *testing.T) {
+	cache := NewLRUCache(3*(1+4), 1, FNV1aHash)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Get([]byte("a"))
+	cache.Set([]byte("d"), []byte("4")) // evicts b, the least recently used
+
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected 'b' to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := cache.Get([]byte(key)); !ok {
+			t.Errorf("Expected %q to be present", key)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package lruxbytes
+
+import "iter"
+
+// All returns an iterator over the entries from most to least recently used, see Range.
+// The loop body runs without the lock held, so it may Del the entries it visits
+func (c *Cache) All() iter.Seq2[[]byte, []byte] {
+	return c.Range
+}
+
+// Backward returns an iterator over the entries from least to most recently used, see RangeReverse
+func (c *Cache) Backward() iter.Seq2[[]byte, []byte] {
+	return c.RangeReverse
+}
+
+// All returns an iterator over the entries of every shard in turn, see ShardedCache.Range
+func (sc *ShardedCache) All() iter.Seq2[[]byte, []byte] {
+	return sc.Range
+}
+
+// Backward returns an iterator walking every shard from least to most recently used
+func (sc *ShardedCache) Backward() iter.Seq2[[]byte, []byte] {
+	return sc.RangeReverse
+}
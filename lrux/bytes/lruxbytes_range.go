@@ -0,0 +1,107 @@
+package lruxbytes
+
+// Range calls fn for every entry from most to least recently used until fn returns false.
+// The entries are collected under the lock and fn runs once it is released, so fn sees the cache
+// as it was when Range started and may call back into it, e.g. to Del the entries it visits.
+// The slices are the cache's own, like the ones Get returns.
+func (c *Cache) Range(fn func(key, value []byte) bool) {
+	for _, e := range c.collect(false) {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// RangeReverse is Range from least to most recently used, the order entries would be evicted in
+func (c *Cache) RangeReverse(fn func(key, value []byte) bool) {
+	for _, e := range c.collect(true) {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// collect copies out the entries from head to tail, or from tail to head when reverse is set
+func (c *Cache) collect(reverse bool) []entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]entry, 0, c.items)
+	idx := c.head
+	if reverse {
+		idx = c.tail
+	}
+	for idx != -1 {
+		entries = append(entries, c.entries[idx])
+		if reverse {
+			idx = c.entries[idx].prev
+		} else {
+			idx = c.entries[idx].next
+		}
+	}
+	return entries
+}
+
+// Keys returns copies of the keys from most to least recently used
+func (c *Cache) Keys() [][]byte {
+	var keys [][]byte
+	c.Range(func(key, _ []byte) bool {
+		keys = append(keys, append([]byte(nil), key...))
+		return true
+	})
+	return keys
+}
+
+// Len returns the number of entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items
+}
+
+// Range calls fn for the entries of every shard in turn until fn returns false, each shard is
+// collected under its own lock so the view is consistent per shard but not across shards
+func (sc *ShardedCache) Range(fn func(key, value []byte) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.Range(func(key, value []byte) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// RangeReverse is Range walking every shard from least to most recently used
+func (sc *ShardedCache) RangeReverse(fn func(key, value []byte) bool) {
+	for _, shard := range sc.shards {
+		stopped := false
+		shard.RangeReverse(func(key, value []byte) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns copies of the keys of every shard, shard by shard
+func (sc *ShardedCache) Keys() [][]byte {
+	var keys [][]byte
+	for _, shard := range sc.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// Len returns the number of entries in every shard, locking one shard at a time
+func (sc *ShardedCache) Len() int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.Len()
+	}
+	return n
+}
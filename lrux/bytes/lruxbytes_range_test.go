@@ -0,0 +1,111 @@
+package lruxbytes
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func rangeKeys(rangeFn func(func(key, value []byte) bool)) []string {
+	var keys []string
+	rangeFn(func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	return keys
+}
+
+func TestRangeOrder(t *testing.T) {
+	cache := NewLRUCache(1024, 1, FNV1aHash)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Set([]byte(key), []byte("value-"+key))
+	}
+	cache.Get([]byte("b"))
+	cache.Del([]byte("c"))
+
+	if got := fmt.Sprint(rangeKeys(cache.Range)); got != "[b d a]" {
+		t.Errorf("Expected most to least recently used [b d a], got %s", got)
+	}
+	if got := fmt.Sprint(rangeKeys(cache.RangeReverse)); got != "[a d b]" {
+		t.Errorf("Expected least to most recently used [a d b], got %s", got)
+	}
+	if cache.Len() != 3 || len(cache.Keys()) != 3 {
+		t.Errorf("Expected 3 entries, got Len %d and %d keys", cache.Len(), len(cache.Keys()))
+	}
+
+	visited := 0
+	cache.RangeReverse(func(key, value []byte) bool {
+		if string(value) != "value-"+string(key) {
+			t.Errorf("Expected value-%s, got %s", key, value)
+		}
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Expected RangeReverse to stop after 1 entry, visited %d", visited)
+	}
+}
+
+func TestRangeDeleteWhileWalking(t *testing.T) {
+	cache := NewLRUCache(1024, 1, FNV1aHash)
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprint(i%2)))
+	}
+
+	// Selective invalidation from inside the walk must not deadlock on the cache lock
+	done := make(chan struct{})
+	go func() {
+		cache.Range(func(key, value []byte) bool {
+			if string(value) == "1" {
+				cache.Del(key)
+			}
+			return true
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Del inside Range not to block")
+	}
+	if cache.Len() != 5 {
+		t.Errorf("Expected the 5 odd entries deleted, %d left", cache.Len())
+	}
+
+	sharded := NewShardedCache(4, 4096, 1, FNV1aHash)
+	for i := 0; i < 20; i++ {
+		sharded.Set([]byte(fmt.Sprintf("key%d", i)), []byte("v"))
+	}
+	sharded.RangeReverse(func(key, _ []byte) bool {
+		sharded.Del(key)
+		return true
+	})
+	if sharded.Len() != 0 {
+		t.Errorf("Expected every entry deleted, %d left", sharded.Len())
+	}
+}
+
+func TestShardedRange(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1, FNV1aHash)
+	var want []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cache.Set([]byte(key), []byte(key))
+		want = append(want, key)
+	}
+	sort.Strings(want)
+
+	for name, got := range map[string][]string{
+		"Range":        rangeKeys(cache.Range),
+		"RangeReverse": rangeKeys(cache.RangeReverse),
+	} {
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected %s to visit every key once, got %d keys", name, len(got))
+		}
+	}
+	if len(cache.Keys()) != 100 || cache.Len() != 100 {
+		t.Errorf("Expected 100 keys, got %d keys and Len %d", len(cache.Keys()), cache.Len())
+	}
+}
@@ -8,18 +8,36 @@ import (
 type ShardedCache struct {
 	shards     []*Cache
 	shardCount uint8
-	hashFunc   ByteHashFunc
+	hashFunc   ByteHashFunc64
 }
 
-// NewShardedCache creates a new ShardedCache with the specified number of shards, total memory limit, eviction count, and a hash function
-func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int, hashFunc ByteHashFunc) *ShardedCache {
+// NewShardedCache creates a new ShardedCache with the specified number of shards, total memory limit, eviction count, and a hash function,
+// the options are applied to every shard
+func NewShardedCache(shardCount uint8, totalMemory int64, evictionCount int, hashFunc ByteHashFunc, opts ...Option) *ShardedCache {
 	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
 		panic(fmt.Errorf("shardCount must be a non-zero power of 2, got %d", shardCount))
 	}
 	maxMemoryPerShard := totalMemory / int64(shardCount)
 	shards := make([]*Cache, shardCount)
 	for i := uint8(0); i < shardCount; i++ {
-		shards[i] = NewLRUCache(maxMemoryPerShard, evictionCount, hashFunc)
+		shards[i] = NewLRUCache(maxMemoryPerShard, evictionCount, hashFunc, opts...)
+	}
+	return &ShardedCache{
+		shards:     shards,
+		shardCount: shardCount,
+		hashFunc:   func(key []byte) uint64 { return uint64(hashFunc(key)) },
+	}
+}
+
+// NewShardedCache64 is NewShardedCache with shards indexing keys by a 64-bit hash
+func NewShardedCache64(shardCount uint8, totalMemory int64, evictionCount int, hashFunc ByteHashFunc64, opts ...Option) *ShardedCache {
+	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
+		panic(fmt.Errorf("shardCount must be a non-zero power of 2, got %d", shardCount))
+	}
+	maxMemoryPerShard := totalMemory / int64(shardCount)
+	shards := make([]*Cache, shardCount)
+	for i := uint8(0); i < shardCount; i++ {
+		shards[i] = NewLRUCache64(maxMemoryPerShard, evictionCount, hashFunc, opts...)
 	}
 	return &ShardedCache{
 		shards:     shards,
@@ -0,0 +1,90 @@
+package lruxbytes
+
+// Stats is a point in time view of a cache's counters and memory usage
+type Stats struct {
+	Hits       uint64 // Get calls that found an entry
+	Misses     uint64 // Get calls that found nothing
+	Sets       uint64 // Entries stored by Set
+	Deletes    uint64 // Entries removed by Del
+	Evictions  uint64 // Entries dropped to make room for new ones
+	Rejected   uint64 // Sets dropped because the entry alone exceeds the memory limit
+	Collisions uint64 // Sets whose key had the same hash as another cached key
+	Bytes      int64  // Estimated memory currently in use
+	MaxBytes   int64  // Memory limit
+	Items      int    // Number of entries currently stored
+}
+
+// HitRatio returns hits / (hits + misses), or 0 before the first Get
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// add accumulates other into s, used to aggregate shards
+func (s *Stats) add(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Sets += other.Sets
+	s.Deletes += other.Deletes
+	s.Evictions += other.Evictions
+	s.Rejected += other.Rejected
+	s.Collisions += other.Collisions
+	s.Bytes += other.Bytes
+	s.MaxBytes += other.MaxBytes
+	s.Items += other.Items
+}
+
+// counters are plain integers since every Cache method already holds the lock
+type counters struct {
+	hits, misses, sets, deletes, evictions, rejected, collisions uint64
+}
+
+// record counts a removal, replacements are not counted since the Set that caused them is
+func (c *counters) record(reason EvictReason) {
+	switch reason {
+	case EvictCapacity:
+		c.evictions++
+	case EvictDeleted:
+		c.deletes++
+	}
+}
+
+// Stats returns the cache's counters and current memory usage
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:       c.stats.hits,
+		Misses:     c.stats.misses,
+		Sets:       c.stats.sets,
+		Deletes:    c.stats.deletes,
+		Evictions:  c.stats.evictions,
+		Rejected:   c.stats.rejected,
+		Collisions: c.stats.collisions,
+		Bytes:      c.currentMemory,
+		MaxBytes:   c.maxMemory,
+		Items:      c.items,
+	}
+}
+
+// Stats returns the counters of all shards added together
+func (sc *ShardedCache) Stats() Stats {
+	var total Stats
+	for _, shard := range sc.shards {
+		total.add(shard.Stats())
+	}
+	return total
+}
+
+// ShardStats returns the counters of every shard, indexed by shard number
+func (sc *ShardedCache) ShardStats() []Stats {
+	stats := make([]Stats, len(sc.shards))
+	for i, shard := range sc.shards {
+		stats[i] = shard.Stats()
+	}
+	return stats
+}
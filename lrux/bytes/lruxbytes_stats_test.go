@@ -0,0 +1,58 @@
+package lruxbytes
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	entrySize := int64(5 + 4)
+	cache := NewLRUCache(2*entrySize, 1, FNV1aHash)
+
+	cache.Set([]byte("a"), []byte("value"))
+	cache.Set([]byte("b"), []byte("value"))
+	cache.Set([]byte("c"), []byte("value")) // evicts a
+	cache.Get([]byte("a"))
+	cache.Get([]byte("b"))
+	cache.Get([]byte("c"))
+	cache.Del([]byte("b"))
+	cache.Del([]byte("b"))
+	cache.Set([]byte("huge"), make([]byte, 100))
+
+	want := Stats{
+		Hits:      2,
+		Misses:    1,
+		Sets:      3,
+		Deletes:   1,
+		Evictions: 1,
+		Rejected:  1,
+		Bytes:     entrySize,
+		MaxBytes:  2 * entrySize,
+		Items:     1,
+	}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Expected stats %+v, got %+v", want, got)
+	}
+}
+
+func TestShardedStats(t *testing.T) {
+	cache := NewShardedCache(4, 4096, 1, FNV1aHash)
+	for i := 0; i < 32; i++ {
+		cache.Set([]byte{byte(i)}, []byte("value"))
+	}
+	for i := 0; i < 64; i++ {
+		cache.Get([]byte{byte(i)})
+	}
+
+	total := cache.Stats()
+	if total.Hits != 32 || total.Misses != 32 || total.Sets != 32 || total.Items != 32 {
+		t.Errorf("Unexpected aggregated stats %+v", total)
+	}
+
+	var sum Stats
+	for _, s := range cache.ShardStats() {
+		sum.add(s)
+	}
+	if sum != total {
+		t.Errorf("Expected shard stats to add up to %+v, got %+v", total, sum)
+	}
+}
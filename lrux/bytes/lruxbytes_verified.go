@@ -0,0 +1,73 @@
+package lruxbytes
+
+import "bytes"
+
+// ByteHashFunc64 is a 64-bit hash function for bytes, xxh3.Hash fits
+type ByteHashFunc64 func([]byte) uint64
+
+// NewLRUCache64 creates a cache indexing keys by a 64-bit hash, making collisions between
+// millions of keys unlikely where a 32-bit hash all but guarantees some
+func NewLRUCache64(maxMemory int64, evictBatchSize int, hashFunc ByteHashFunc64, opts ...Option) *Cache {
+	return NewLRUCache(maxMemory, evictBatchSize, nil, append([]Option{func(c *Cache) { c.hashFunc64 = hashFunc }}, opts...)...)
+}
+
+// WithVerifiedKeys makes the cache compare the stored key on every Get, Set and Del instead of
+// trusting the hash alone. Keys with the same hash are chained in the same index bucket, so a
+// collision can no longer return or overwrite another key's value. It costs a key comparison
+// per lookup, the keys are kept by the cache either way.
+func WithVerifiedKeys() Option {
+	return func(c *Cache) {
+		c.verified = true
+	}
+}
+
+// lookup returns the slot of key. Without verification the first entry with the same hash is
+// taken for it.
+func (c *Cache) lookup(key []byte) (int, bool) {
+	idx, ok := c.indexMap[c.hashKey(key)]
+	if !ok {
+		return -1, false
+	}
+	if !c.verified {
+		return int(idx), true
+	}
+	for i := int(idx); i != -1; i = c.entries[i].chain {
+		if bytes.Equal(c.entries[i].key, key) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// link indexes the entry in slot under hash, in front of the chain of the other keys sharing it
+func (c *Cache) link(slot int, hash uint64) {
+	if head, ok := c.indexMap[hash]; ok && c.verified {
+		c.entries[slot].chain = int(head)
+	}
+	c.indexMap[hash] = uint32(slot)
+	c.items++
+}
+
+// unlink removes the entry in slot from the index
+func (c *Cache) unlink(slot int) {
+	c.items--
+	hash := c.hashKey(c.entries[slot].key)
+	next := c.entries[slot].chain
+	c.entries[slot].chain = -1
+
+	head := int(c.indexMap[hash])
+	if head == slot {
+		if next == -1 {
+			delete(c.indexMap, hash)
+		} else {
+			c.indexMap[hash] = uint32(next)
+		}
+		return
+	}
+	for i := head; i != -1; i = c.entries[i].chain {
+		if c.entries[i].chain == slot {
+			c.entries[i].chain = next
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package lruxbytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/zeebo/xxh3"
+)
+
+// lengthHash makes every key of the same length collide
+func lengthHash(key []byte) uint32 {
+	return uint32(len(key))
+}
+
+// checkIndex verifies every linked entry is found through the index and Items matches
+func checkIndex(t *testing.T, c *Cache) {
+	t.Helper()
+	linked := 0
+	for i := c.head; i != -1; i = c.entries[i].next {
+		if idx, ok := c.lookup(c.entries[i].key); !ok || idx != i {
+			t.Fatalf("Entry %q in slot %d is indexed at %d, %v", c.entries[i].key, i, idx, ok)
+		}
+		linked++
+	}
+	if linked != c.items {
+		t.Fatalf("%d entries linked, %d items counted", linked, c.items)
+	}
+}
+
+func TestCollisionsWithoutVerification(t *testing.T) {
+	cache := NewLRUCache(4096, 1, lengthHash)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	// b overwrote a, and a reads b's value
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "2" {
+		t.Fatalf("Expected the colliding key to return the other value, got %q, %v", value, ok)
+	}
+	if got := cache.Stats().Collisions; got != 1 {
+		t.Errorf("Expected 1 collision, got %d", got)
+	}
+}
+
+func TestVerifiedKeys(t *testing.T) {
+	cache := NewLRUCache(4096, 1, lengthHash, WithVerifiedKeys())
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if value, ok := cache.Get([]byte(key)); !ok || string(value) != want {
+			t.Errorf("Expected %s -> %s, got %q, %v", key, want, value, ok)
+		}
+	}
+	if _, ok := cache.Get([]byte("d")); ok {
+		t.Errorf("Expected a colliding key that was never set to miss")
+	}
+
+	// Deleting from the middle and the head of the chain keeps the rest reachable
+	cache.Del([]byte("b"))
+	cache.Del([]byte("d"))
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be deleted")
+	}
+	cache.Set([]byte("c"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	if value, ok := cache.Get([]byte("c")); !ok || string(value) != "updated" {
+		t.Errorf("Expected c -> updated, got %q, %v", value, ok)
+	}
+
+	stats := cache.Stats()
+	if stats.Collisions != 2 || stats.Items != 2 {
+		t.Errorf("Expected 2 collisions and 2 items, got %+v", stats)
+	}
+	checkIndex(t, cache)
+}
+
+func TestVerifiedEviction(t *testing.T) {
+	entrySize := int64(1 + 4)
+	cache := NewLRUCache(3*entrySize, 1, lengthHash, WithVerifiedKeys())
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		cache.Set([]byte(key), []byte(key))
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := cache.Get([]byte(key)); ok {
+			t.Errorf("Expected %s to be evicted", key)
+		}
+	}
+	for _, key := range []string{"c", "d", "e"} {
+		if value, ok := cache.Get([]byte(key)); !ok || string(value) != key {
+			t.Errorf("Expected %s -> %s, got %q, %v", key, key, value, ok)
+		}
+	}
+	checkIndex(t, cache)
+}
+
+func TestVerifiedRandomOperations(t *testing.T) {
+	// 8 buckets for 200 keys, every chain is long
+	hash := func(key []byte) uint32 { return FNV1aHash(key) & 7 }
+	cache := NewLRUCache(2048, 2, hash, WithVerifiedKeys())
+	model := make(map[string]string)
+	rng := rand.New(rand.NewSource(7))
+
+	for i := 0; i < 50000; i++ {
+		key := fmt.Sprintf("key%d", rng.Intn(200))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del([]byte(key))
+			delete(model, key)
+		case 1:
+			value := fmt.Sprintf("value%d", i)
+			cache.Set([]byte(key), []byte(value))
+			model[key] = value
+		default:
+			if got, ok := cache.Get([]byte(key)); ok && string(got) != model[key] {
+				t.Fatalf("Expected %s -> %q, got %q", key, model[key], got)
+			}
+		}
+	}
+	checkIndex(t, cache)
+}
+
+func TestHash64(t *testing.T) {
+	cache := NewShardedCache64(4, 64*1024, 1, xxh3.Hash, WithVerifiedKeys())
+	for i := 0; i < 1000; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if value, ok := cache.Get([]byte(fmt.Sprintf("key%d", i))); !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	if stats := cache.Stats(); stats.Collisions != 0 || stats.Items != 1000 {
+		t.Errorf("Expected 1000 items without collisions, got %+v", stats)
+	}
+
+	single := NewLRUCache64(4096, 1, xxh3.Hash)
+	single.Set([]byte("a"), []byte("1"))
+	if value, ok := single.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+}
@@ -0,0 +1,25 @@
+package cachemetrics
+
+import (
+	"expvar"
+)
+
+// expvarView is what a published cache looks like under /debug/vars
+type expvarView struct {
+	Total  Snapshot   `json:"total"`
+	Shards []Snapshot `json:"shards"`
+}
+
+// Publish exposes source under name in expvar, with the aggregated totals and every shard.
+// Like expvar.Publish it panics if name is already in use.
+func Publish(name string, source Source) {
+	expvar.Publish(name, Var(source))
+}
+
+// Var returns an expvar.Var rendering source, for callers that publish it themselves, e.g. inside an expvar.Map
+func Var(source Source) expvar.Var {
+	return expvar.Func(func() any {
+		shards := source.Snapshots()
+		return expvarView{Total: Total(shards), Shards: shards}
+	})
+}
@@ -0,0 +1,28 @@
+module github.com/cloudxaas/gocache/metrics
+
+go 1.22.2
+
+require (
+	github.com/cloudxaas/gocache/lru/bytes v0.0.0
+	github.com/cloudxaas/gocache/lrux/bytes v0.0.0
+	github.com/prometheus/client_golang v1.19.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/cloudxaas/gocx v0.0.3 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+replace (
+	github.com/cloudxaas/gocache/lru/bytes => ../lru/bytes
+	github.com/cloudxaas/gocache/lrux/bytes => ../lrux/bytes
+)
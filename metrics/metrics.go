@@ -0,0 +1,102 @@
+// Package cachemetrics exports the Stats of the gocache byte caches to Prometheus and expvar.
+//
+// It lives in its own module so the cache packages themselves stay free of the
+// Prometheus dependency.
+package cachemetrics
+
+import (
+	lrubytes "github.com/cloudxaas/gocache/lru/bytes"
+	lruxbytes "github.com/cloudxaas/gocache/lrux/bytes"
+)
+
+// Snapshot is the cache independent view of one shard's Stats
+type Snapshot struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Sets        uint64 `json:"sets"`
+	Deletes     uint64 `json:"deletes"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Rejected    uint64 `json:"rejected"`
+	Collisions  uint64 `json:"collisions"`
+	Bytes       int64  `json:"bytes"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Items       int    `json:"items"`
+}
+
+// Source returns one Snapshot per shard, in shard order
+type Source interface {
+	Snapshots() []Snapshot
+}
+
+// SourceFunc adapts a plain function to a Source
+type SourceFunc func() []Snapshot
+
+func (f SourceFunc) Snapshots() []Snapshot {
+	return f()
+}
+
+// LRUBytes reads the per-shard Stats of a lrubytes.ShardedCache
+func LRUBytes(sc *lrubytes.ShardedCache) Source {
+	return SourceFunc(func() []Snapshot {
+		stats := sc.ShardStats()
+		snapshots := make([]Snapshot, len(stats))
+		for i, s := range stats {
+			snapshots[i] = Snapshot{
+				Hits:        s.Hits,
+				Misses:      s.Misses,
+				Sets:        s.Sets,
+				Deletes:     s.Deletes,
+				Evictions:   s.Evictions,
+				Expirations: s.Expirations,
+				Rejected:    s.Rejected,
+				Bytes:       s.Bytes,
+				MaxBytes:    s.MaxBytes,
+				Items:       s.Items,
+			}
+		}
+		return snapshots
+	})
+}
+
+// LRUXBytes reads the per-shard Stats of a lruxbytes.ShardedCache
+func LRUXBytes(sc *lruxbytes.ShardedCache) Source {
+	return SourceFunc(func() []Snapshot {
+		stats := sc.ShardStats()
+		snapshots := make([]Snapshot, len(stats))
+		for i, s := range stats {
+			snapshots[i] = Snapshot{
+				Hits:       s.Hits,
+				Misses:     s.Misses,
+				Sets:       s.Sets,
+				Deletes:    s.Deletes,
+				Evictions:  s.Evictions,
+				Rejected:   s.Rejected,
+				Collisions: s.Collisions,
+				Bytes:      s.Bytes,
+				MaxBytes:   s.MaxBytes,
+				Items:      s.Items,
+			}
+		}
+		return snapshots
+	})
+}
+
+// Total adds the shard snapshots together
+func Total(snapshots []Snapshot) Snapshot {
+	var total Snapshot
+	for _, s := range snapshots {
+		total.Hits += s.Hits
+		total.Misses += s.Misses
+		total.Sets += s.Sets
+		total.Deletes += s.Deletes
+		total.Evictions += s.Evictions
+		total.Expirations += s.Expirations
+		total.Rejected += s.Rejected
+		total.Collisions += s.Collisions
+		total.Bytes += s.Bytes
+		total.MaxBytes += s.MaxBytes
+		total.Items += s.Items
+	}
+	return total
+}
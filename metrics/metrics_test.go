@@ -0,0 +1,99 @@
+package cachemetrics
+
+import (
+	"encoding/json"
+	"testing"
+
+	lrubytes "github.com/cloudxaas/gocache/lru/bytes"
+	lruxbytes "github.com/cloudxaas/gocache/lrux/bytes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func fnv1a(key []byte) uint32 {
+	hash := uint32(2166136261)
+	for _, c := range key {
+		hash ^= uint32(c)
+		hash *= 16777619
+	}
+	return hash
+}
+
+func TestCollector(t *testing.T) {
+	cache := lrubytes.NewShardedCache(4, 4096, 1)
+	for i := 0; i < 16; i++ {
+		cache.Set([]byte{byte(i)}, []byte("value"))
+		cache.Get([]byte{byte(i)})
+	}
+	xcache := lruxbytes.NewShardedCache(2, 4096, 1, fnv1a)
+	xcache.Get([]byte("missing"))
+	collide := lruxbytes.NewShardedCache(1, 4096, 1, func([]byte) uint32 { return 0 }, lruxbytes.WithVerifiedKeys())
+	collide.Set([]byte("a"), []byte("1"))
+	collide.Set([]byte("b"), []byte("2"))
+
+	reg := prometheus.NewRegistry()
+	if _, err := Register(reg, "sessions", LRUBytes(cache)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Register(reg, "pages", LRUXBytes(xcache)); err != nil {
+		t.Fatalf("Expected a second cache to register under another name: %v", err)
+	}
+	if _, err := Register(reg, "ids", LRUXBytes(collide)); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totals := map[string]map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if totals[labels["cache"]] == nil {
+				totals[labels["cache"]] = map[string]float64{}
+			}
+			value := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+			totals[labels["cache"]][family.GetName()] += value
+		}
+	}
+
+	if got := totals["sessions"]["gocache_hits_total"]; got != 16 {
+		t.Errorf("Expected 16 hits for sessions, got %v", got)
+	}
+	if got := totals["sessions"]["gocache_items"]; got != 16 {
+		t.Errorf("Expected 16 items for sessions, got %v", got)
+	}
+	if got := totals["sessions"]["gocache_max_bytes"]; got != 4096 {
+		t.Errorf("Expected 4096 max bytes for sessions, got %v", got)
+	}
+	if got := totals["pages"]["gocache_misses_total"]; got != 1 {
+		t.Errorf("Expected 1 miss for pages, got %v", got)
+	}
+	if got := totals["ids"]["gocache_collisions_total"]; got != 1 {
+		t.Errorf("Expected 1 collision for ids, got %v", got)
+	}
+	if got := Total(LRUXBytes(collide).Snapshots()).Collisions; got != 1 {
+		t.Errorf("Expected the snapshot total to carry 1 collision, got %d", got)
+	}
+}
+
+func TestVar(t *testing.T) {
+	cache := lrubytes.NewShardedCache(2, 4096, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Get([]byte("a"))
+
+	var view expvarView
+	if err := json.Unmarshal([]byte(Var(LRUBytes(cache)).String()), &view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.Shards) != 2 {
+		t.Errorf("Expected 2 shards, got %d", len(view.Shards))
+	}
+	if view.Total.Hits != 1 || view.Total.Items != 1 {
+		t.Errorf("Unexpected totals %+v", view.Total)
+	}
+}
@@ -0,0 +1,92 @@
+package cachemetrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector exposes a cache's per-shard Stats as Prometheus metrics labelled by cache name and shard
+type Collector struct {
+	source Source
+
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	sets        *prometheus.Desc
+	deletes     *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	rejected    *prometheus.Desc
+	collisions  *prometheus.Desc
+	bytes       *prometheus.Desc
+	maxBytes    *prometheus.Desc
+	items       *prometheus.Desc
+}
+
+// NewCollector creates a Collector for source, name becomes the "cache" label so several caches can share a registry
+func NewCollector(name string, source Source) *Collector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName("gocache", "", metric),
+			help,
+			[]string{"shard"},
+			prometheus.Labels{"cache": name},
+		)
+	}
+	return &Collector{
+		source:      source,
+		hits:        desc("hits_total", "Number of Get calls that found an entry."),
+		misses:      desc("misses_total", "Number of Get calls that found nothing."),
+		sets:        desc("sets_total", "Number of entries stored."),
+		deletes:     desc("deletes_total", "Number of entries removed by Del."),
+		evictions:   desc("evictions_total", "Number of entries dropped to make room for new ones."),
+		expirations: desc("expirations_total", "Number of entries removed because their TTL passed."),
+		rejected:    desc("rejected_total", "Number of sets dropped because the entry exceeds the shard memory limit."),
+		collisions:  desc("collisions_total", "Number of sets whose key hash was already used by another key, lruxbytes only."),
+		bytes:       desc("bytes", "Estimated memory in use."),
+		maxBytes:    desc("max_bytes", "Memory limit."),
+		items:       desc("items", "Number of entries stored."),
+	}
+}
+
+// Register creates a Collector for source and registers it with reg
+func Register(reg prometheus.Registerer, name string, source Source) (*Collector, error) {
+	c := NewCollector(name, source)
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.rejected
+	ch <- c.collisions
+	ch <- c.bytes
+	ch <- c.maxBytes
+	ch <- c.items
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for i, s := range c.source.Snapshots() {
+		shard := strconv.Itoa(i)
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits), shard)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses), shard)
+		ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(s.Sets), shard)
+		ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(s.Deletes), shard)
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions), shard)
+		ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(s.Expirations), shard)
+		ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(s.Rejected), shard)
+		ch <- prometheus.MustNewConstMetric(c.collisions, prometheus.CounterValue, float64(s.Collisions), shard)
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(s.Bytes), shard)
+		ch <- prometheus.MustNewConstMetric(c.maxBytes, prometheus.GaugeValue, float64(s.MaxBytes), shard)
+		ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(s.Items), shard)
+	}
+}
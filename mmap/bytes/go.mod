@@ -0,0 +1,7 @@
+module github.com/cloudxaas/gocache/mmap/bytes
+
+go 1.22.2
+
+require github.com/zeebo/xxh3 v1.0.2
+
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
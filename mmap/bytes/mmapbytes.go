@@ -0,0 +1,296 @@
+package mmapbytes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+	"sync"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Entry layout in the ring: hash (8) | key len (4) | value len (4) | flags (1) | key | value
+const (
+	entryHeader  = 17
+	flagsOffset  = 16
+	flagAccessed = 1 << 0 // Read since it was written or last given a second chance
+)
+
+// slot is one bucket of the open addressing index, hash 0 marks an empty bucket
+type slot struct {
+	hash uint64
+	off  uint64 // Offset of the entry in the ring
+}
+
+// Cache is a memory bounded cache whose entries and index live in anonymous mmap'd regions
+// outside the Go heap, so a cache of tens of gigabytes adds nothing for the GC to scan and
+// does not grow the heap target.
+//
+// Entries are appended to a ring and reclaimed from its oldest end. Like CLOCK, an entry read
+// since it was written gets a second chance and moves to the newest end instead of being
+// evicted. The index is a linear probing hash table of (hash, offset) pairs, keys are compared
+// on every lookup so hash collisions never return the wrong value. Overwritten and deleted
+// entries leave the index at once, their bytes are reclaimed when the oldest end reaches them.
+//
+// Get returns a copy of the value, the ring is reused and is unmapped by Close.
+type Cache struct {
+	data       []byte // Entry ring
+	index      []byte // Mapping holding table
+	table      []slot
+	mask       uint64
+	count      int // Live entries in the table
+	maxEntries int
+	head       uint64 // Where the next entry is written
+	tail       uint64 // Oldest entry
+	used       uint64 // Bytes between tail and head, dead entries included
+	scratch    []byte // Holds an entry given a second chance while it moves
+	mu         sync.Mutex
+}
+
+// NewMmapCache maps maxMemory bytes for entries plus an index of 16 byte slots with room for
+// maxEntries, rounded up to a power of 2. Entries are evicted once either limit is reached.
+func NewMmapCache(maxMemory int64, maxEntries int) (*Cache, error) {
+	if maxMemory <= 0 || maxEntries <= 0 {
+		return nil, fmt.Errorf("cxmmapbytes maxMemory and maxEntries must be positive, got %d and %d", maxMemory, maxEntries)
+	}
+	// Keep the table at most 3/4 full so probe sequences stay short
+	slots := uint64(1) << bits.Len64(uint64(maxEntries+maxEntries/3))
+
+	data, err := mapRegion(int(maxMemory))
+	if err != nil {
+		return nil, fmt.Errorf("cxmmapbytes mapping %d bytes of entries: %w", maxMemory, err)
+	}
+	index, err := mapRegion(int(slots) * int(unsafe.Sizeof(slot{})))
+	if err != nil {
+		unmapRegion(data)
+		return nil, fmt.Errorf("cxmmapbytes mapping an index of %d slots: %w", slots, err)
+	}
+	return &Cache{
+		data:       data,
+		index:      index,
+		table:      unsafe.Slice((*slot)(unsafe.Pointer(&index[0])), slots),
+		mask:       slots - 1,
+		maxEntries: maxEntries,
+	}, nil
+}
+
+// Close unmaps the cache's memory, the cache is empty and ignores Sets afterwards
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		return nil
+	}
+	err := unmapRegion(c.data)
+	if indexErr := unmapRegion(c.index); err == nil {
+		err = indexErr
+	}
+	c.data, c.index, c.table = nil, nil, nil
+	c.count, c.head, c.tail, c.used = 0, 0, 0, 0
+	return err
+}
+
+func hashKey(key []byte) uint64 {
+	if hash := xxh3.Hash(key); hash != 0 {
+		return hash
+	}
+	return 1 // 0 marks empty slots
+}
+
+// read copies len(dst) bytes starting at off, wrapping around the end of the ring
+func (c *Cache) read(off uint64, dst []byte) {
+	n := copy(dst, c.data[off:])
+	copy(dst[n:], c.data)
+}
+
+// write copies data to off, wrapping around the end of the ring, and returns the offset after it
+func (c *Cache) write(off uint64, data []byte) uint64 {
+	n := copy(c.data[off:], data)
+	copy(c.data, data[n:])
+	return c.at(off, uint64(len(data)))
+}
+
+func (c *Cache) at(off, delta uint64) uint64 {
+	return (off + delta) % uint64(len(c.data))
+}
+
+// header returns the hash, key length, value length and flags of the entry at off
+func (c *Cache) header(off uint64) (hash uint64, keyLen, valueLen uint32, flags byte) {
+	var h [entryHeader]byte
+	c.read(off, h[:])
+	return binary.LittleEndian.Uint64(h[0:]), binary.LittleEndian.Uint32(h[8:]), binary.LittleEndian.Uint32(h[12:]), h[flagsOffset]
+}
+
+// keyEquals compares the key of the entry at off with key without copying it
+func (c *Cache) keyEquals(off uint64, key []byte) bool {
+	var keyLen [4]byte
+	c.read(c.at(off, 8), keyLen[:])
+	if binary.LittleEndian.Uint32(keyLen[:]) != uint32(len(key)) {
+		return false
+	}
+	start := c.at(off, entryHeader)
+	n := min(uint64(len(key)), uint64(len(c.data))-start)
+	return bytes.Equal(c.data[start:start+n], key[:n]) && bytes.Equal(c.data[:uint64(len(key))-n], key[n:])
+}
+
+// find returns the slot of key, or the empty slot where it would go
+func (c *Cache) find(hash uint64, key []byte) (uint64, bool) {
+	for i := hash & c.mask; ; i = (i + 1) & c.mask {
+		s := c.table[i]
+		if s.hash == 0 {
+			return i, false
+		}
+		if s.hash == hash && c.keyEquals(s.off, key) {
+			return i, true
+		}
+	}
+}
+
+// slotOf returns the slot pointing at the entry at off, there is none if the entry is dead
+func (c *Cache) slotOf(hash, off uint64) (uint64, bool) {
+	for i := hash & c.mask; ; i = (i + 1) & c.mask {
+		s := c.table[i]
+		if s.hash == 0 {
+			return 0, false
+		}
+		if s.hash == hash && s.off == off {
+			return i, true
+		}
+	}
+}
+
+// removeSlot empties slot i, shifting back the entries of its probe sequence so lookups never
+// stop early at the hole
+func (c *Cache) removeSlot(i uint64) {
+	c.count--
+	for j := (i + 1) & c.mask; c.table[j].hash != 0; j = (j + 1) & c.mask {
+		home := c.table[j].hash & c.mask
+		// The entry at j may only move back to i if its home is not cyclically within (i, j]
+		if (j > i && (home <= i || home > j)) || (j < i && home <= i && home > j) {
+			c.table[i] = c.table[j]
+			i = j
+		}
+	}
+	c.table[i] = slot{}
+}
+
+// Get returns a copy of the value of key
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	return c.GetInto(key, nil)
+}
+
+// GetInto appends the value of key to dst, reusing dst across calls reads without allocating
+func (c *Cache) GetInto(key, dst []byte) ([]byte, bool) {
+	hash := hashKey(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		return dst, false
+	}
+
+	i, ok := c.find(hash, key)
+	if !ok {
+		return dst, false
+	}
+	off := c.table[i].off
+	_, keyLen, valueLen, flags := c.header(off)
+	c.data[c.at(off, flagsOffset)] = flags | flagAccessed
+
+	n := len(dst)
+	dst = slices.Grow(dst, int(valueLen))[:n+int(valueLen)]
+	c.read(c.at(off, entryHeader+uint64(keyLen)), dst[n:])
+	return dst, true
+}
+
+// Set copies key and value into the cache. An entry larger than the whole ring is not stored,
+// and the old value of key is dropped all the same.
+func (c *Cache) Set(key, value []byte) error {
+	hash := hashKey(key)
+	size := entryHeader + uint64(len(key)) + uint64(len(value))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		return nil
+	}
+
+	if i, ok := c.find(hash, key); ok {
+		c.removeSlot(i)
+	}
+	if size > uint64(len(c.data)) {
+		return nil
+	}
+	for c.used+size > uint64(len(c.data)) || c.count >= c.maxEntries {
+		c.reclaim()
+	}
+
+	var h [entryHeader]byte
+	binary.LittleEndian.PutUint64(h[0:], hash)
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(h[12:], uint32(len(value)))
+
+	off := c.head
+	c.head = c.write(c.head, h[:])
+	c.head = c.write(c.head, key)
+	c.head = c.write(c.head, value)
+	c.used += size
+
+	// Reclaiming may have shifted the table, look for the empty slot again
+	i, _ := c.find(hash, key)
+	c.table[i] = slot{hash: hash, off: off}
+	c.count++
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	hash := hashKey(key)
+
+	c.mu.Lock()
+	if c.data != nil {
+		if i, ok := c.find(hash, key); ok {
+			c.removeSlot(i)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Len returns the number of entries in the cache
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+// reclaim frees the oldest entry of the ring, moving it to the newest end instead if it was read
+// since it was written. Caller must hold the lock and make sure the ring is not empty.
+func (c *Cache) reclaim() {
+	off := c.tail
+	hash, keyLen, valueLen, flags := c.header(off)
+	size := entryHeader + uint64(keyLen) + uint64(valueLen)
+	c.tail = c.at(c.tail, size)
+	c.used -= size
+
+	i, live := c.slotOf(hash, off)
+	if !live {
+		return // Overwritten or deleted
+	}
+	if flags&flagAccessed == 0 {
+		c.removeSlot(i)
+		return
+	}
+
+	// Second chance, the bytes just freed at the tail are enough to move it to the head
+	if uint64(cap(c.scratch)) < size {
+		c.scratch = make([]byte, size)
+	}
+	entry := c.scratch[:size]
+	c.read(off, entry)
+	entry[flagsOffset] &^= flagAccessed
+	c.table[i].off = c.head
+	c.head = c.write(c.head, entry)
+	c.used += size
+}
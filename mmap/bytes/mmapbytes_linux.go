@@ -0,0 +1,14 @@
+//go:build linux
+
+package mmapbytes
+
+import "syscall"
+
+// mapRegion maps size bytes of anonymous memory, outside the Go heap
+func mapRegion(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func unmapRegion(region []byte) error {
+	return syscall.Munmap(region)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package mmapbytes
+
+// mapRegion falls back to a heap allocation without pointers, which the GC does not scan but
+// which still counts towards the heap size
+func mapRegion(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+func unmapRegion(region []byte) error {
+	return nil
+}
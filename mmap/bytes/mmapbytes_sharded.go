@@ -0,0 +1,83 @@
+package mmapbytes
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/xxh3"
+)
+
+// ShardedCache struct containing multiple Cache shards
+type ShardedCache struct {
+	shards     []*Cache
+	shardCount uint8
+}
+
+// NewShardedCache creates a new ShardedCache with the specified number of shards, the total memory
+// and entry limits are split evenly between them
+func NewShardedCache(shardCount uint8, totalMemory int64, totalEntries int) (*ShardedCache, error) {
+	if shardCount == 0 || (shardCount&(shardCount-1)) != 0 {
+		return nil, fmt.Errorf("cxmmapbytes shardCount must be a non-zero power of 2, got %d", shardCount)
+	}
+	shards := make([]*Cache, shardCount)
+	for i := range shards {
+		shard, err := NewMmapCache(totalMemory/int64(shardCount), max(totalEntries/int(shardCount), 1))
+		if err != nil {
+			for _, created := range shards[:i] {
+				created.Close()
+			}
+			return nil, err
+		}
+		shards[i] = shard
+	}
+	return &ShardedCache{
+		shards:     shards,
+		shardCount: shardCount,
+	}, nil
+}
+
+// getShard computes the hash of the key to determine which shard to use. The shard comes from
+// the top bits since a shard's index uses the low bits for the home slot, taking the shard from
+// those too would crowd all its keys into 1/shardCount of its buckets
+func (sc *ShardedCache) getShard(key []byte) *Cache {
+	hash := xxh3.Hash(key)
+	return sc.shards[uint8(hash>>56)&(sc.shardCount-1)]
+}
+
+// Get retrieves a copy of the value from the appropriate shard
+func (sc *ShardedCache) Get(key []byte) ([]byte, bool) {
+	return sc.getShard(key).Get(key)
+}
+
+// GetInto appends the value from the appropriate shard to dst
+func (sc *ShardedCache) GetInto(key, dst []byte) ([]byte, bool) {
+	return sc.getShard(key).GetInto(key, dst)
+}
+
+// Set adds a key-value pair to the appropriate shard
+func (sc *ShardedCache) Set(key, value []byte) {
+	sc.getShard(key).Set(key, value)
+}
+
+// Del removes a key from the appropriate shard
+func (sc *ShardedCache) Del(key []byte) {
+	sc.getShard(key).Del(key)
+}
+
+// Len returns the number of entries over all shards
+func (sc *ShardedCache) Len() int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Close unmaps the memory of every shard
+func (sc *ShardedCache) Close() error {
+	var err error
+	for _, shard := range sc.shards {
+		err = errors.Join(err, shard.Close())
+	}
+	return err
+}
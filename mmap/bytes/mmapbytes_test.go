@@ -0,0 +1,316 @@
+package mmapbytes
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func newCache(t testing.TB, maxMemory int64, maxEntries int) *Cache {
+	t.Helper()
+	cache, err := NewMmapCache(maxMemory, maxEntries)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+// checkInvariants walks the ring from tail to head and checks it against the table
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var walked uint64
+	live := 0
+	for off := c.tail; walked < c.used; {
+		hash, keyLen, valueLen, _ := c.header(off)
+		if _, ok := c.slotOf(hash, off); ok {
+			live++
+		}
+		size := entryHeader + uint64(keyLen) + uint64(valueLen)
+		walked += size
+		off = c.at(off, size)
+	}
+	if walked != c.used {
+		t.Fatalf("Ring walk covered %d bytes, used is %d", walked, c.used)
+	}
+	if c.at(c.tail, c.used) != c.head {
+		t.Fatalf("Tail %d plus used %d does not reach head %d", c.tail, c.used, c.head)
+	}
+
+	indexed := 0
+	for i, s := range c.table {
+		if s.hash == 0 {
+			continue
+		}
+		indexed++
+		// Every slot must be reachable from its home without crossing an empty slot
+		for j := s.hash & c.mask; j != uint64(i); j = (j + 1) & c.mask {
+			if c.table[j].hash == 0 {
+				t.Fatalf("Slot %d is cut off from its home %d by the empty slot %d", i, s.hash&c.mask, j)
+			}
+		}
+	}
+	if live != indexed || indexed != c.count || c.count > c.maxEntries {
+		t.Fatalf("%d live entries in the ring, %d indexed, count %d, max %d", live, indexed, c.count, c.maxEntries)
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	cache := newCache(t, 1024, 64)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("a"))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	cache.Set([]byte("b"), make([]byte, 2048))
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected an entry larger than the cache to be rejected and drop the old value")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestValuesAreCopies(t *testing.T) {
+	cache := newCache(t, 1024, 64)
+	key, value := []byte("key"), []byte("value")
+	cache.Set(key, value)
+	key[0], value[0] = 'X', 'X'
+
+	got, ok := cache.Get([]byte("key"))
+	if !ok || string(got) != "value" {
+		t.Fatalf("Expected the cache to keep its own copy, got %q, %v", got, ok)
+	}
+	got[0] = 'Y'
+	buf := make([]byte, 0, 16)
+	if again, _ := cache.GetInto([]byte("key"), buf); string(again) != "value" || &again[0] != &buf[:1][0] {
+		t.Errorf("Expected value read into the caller's buffer, got %q", again)
+	}
+}
+
+func TestReadEntriesGetSecondChance(t *testing.T) {
+	entrySize := int64(entryHeader + 2 + 8)
+	cache := newCache(t, 4*entrySize, 64)
+	for i := 0; i < 4; i++ {
+		cache.Set([]byte(fmt.Sprintf("k%d", i)), make([]byte, 8))
+	}
+	cache.Get([]byte("k0"))
+	cache.Set([]byte("k4"), make([]byte, 8))
+
+	if _, ok := cache.Get([]byte("k1")); ok {
+		t.Errorf("Expected k1, the oldest entry nobody read, to be evicted")
+	}
+	for _, key := range []string{"k0", "k2", "k3", "k4"} {
+		if _, ok := cache.Get([]byte(key)); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestEntryLimit(t *testing.T) {
+	cache := newCache(t, 1<<20, 100)
+	for i := 0; i < 1000; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte("v"))
+	}
+	if cache.Len() != 100 {
+		t.Errorf("Expected the entry limit to hold 100 entries, got %d", cache.Len())
+	}
+	if _, ok := cache.Get([]byte("key999")); !ok {
+		t.Errorf("Expected the newest entry to be cached")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestRandomOperations(t *testing.T) {
+	// A ring size that is not a multiple of the entry sizes makes entries straddle its end, and a
+	// small table makes probe sequences collide
+	cache := newCache(t, 4000, 200)
+	model := make(map[string]string)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100000; i++ {
+		key := fmt.Sprintf("key%d", rng.Intn(500))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del([]byte(key))
+			delete(model, key)
+		case 1:
+			value := fmt.Sprintf("%d-%s", i, make([]byte, rng.Intn(64)))
+			cache.Set([]byte(key), []byte(value))
+			model[key] = value
+		default:
+			// Evicted entries may be missing, but a hit must be the latest value
+			if got, ok := cache.Get([]byte(key)); ok && string(got) != model[key] {
+				t.Fatalf("Expected %s -> %q, got %q", key, model[key], got)
+			}
+		}
+		if i%5000 == 0 {
+			checkInvariants(t, cache)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestClose(t *testing.T) {
+	cache := newCache(t, 1024, 64)
+	cache.Set([]byte("a"), []byte("1"))
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cache.Set([]byte("b"), []byte("2"))
+	if _, ok := cache.Get([]byte("a")); ok || cache.Len() != 0 {
+		t.Errorf("Expected a closed cache to be empty")
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("Expected a second Close to be a no-op, got %v", err)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	cache, err := NewShardedCache(4, 1<<20, 10000)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := []byte(fmt.Sprintf("g%d-key%d", g, i))
+				cache.Set(key, key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if cache.Len() != 4000 {
+		t.Errorf("Expected 4000 entries, got %d", cache.Len())
+	}
+	for g := 0; g < 4; g++ {
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("g%d-key%d", g, i))
+			if value, ok := cache.Get(key); !ok || string(value) != string(key) {
+				t.Fatalf("Expected %s to read back, got %q, %v", key, value, ok)
+			}
+		}
+	}
+	cache.Del([]byte("g0-key1"))
+	if _, ok := cache.Get([]byte("g0-key1")); ok {
+		t.Errorf("Expected g0-key1 to be deleted")
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+// missProbes returns the average number of slots a lookup of an absent key visits in every shard
+func missProbes(sc *ShardedCache) float64 {
+	probes, lookups := 0, 0
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("missing%d", i))
+		c := sc.getShard(key)
+		c.mu.Lock()
+		hash := hashKey(key)
+		for j := hash & c.mask; ; j = (j + 1) & c.mask {
+			probes++
+			if c.table[j].hash == 0 {
+				break
+			}
+		}
+		c.mu.Unlock()
+		lookups++
+	}
+	return float64(probes) / float64(lookups)
+}
+
+func TestShardedProbeLength(t *testing.T) {
+	for _, shardCount := range []uint8{1, 16, 64} {
+		cache, err := NewShardedCache(shardCount, 64<<20, 64*1024)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		// Fill the index about 3/4 full as the entry limit allows
+		for i := 0; i < 64*1024; i++ {
+			cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+		}
+		// Keys spread over the whole table keep misses at a few probes, keys of a shard all
+		// landing in a fraction of its buckets turn the table into one long cluster
+		if probes := missProbes(cache); probes > 4 {
+			t.Errorf("Expected a miss to probe at most 4 slots on average with %d shards, got %.1f", shardCount, probes)
+		}
+		cache.Close()
+	}
+}
+
+func TestInvalidArguments(t *testing.T) {
+	for _, args := range [][2]int{{0, 10}, {1024, 0}, {-1, 10}} {
+		if _, err := NewMmapCache(int64(args[0]), args[1]); err == nil {
+			t.Errorf("Expected an error for maxMemory %d and maxEntries %d", args[0], args[1])
+		}
+	}
+	for _, shardCount := range []uint8{0, 3, 12} {
+		if _, err := NewShardedCache(shardCount, 1<<20, 1000); err == nil {
+			t.Errorf("Expected an error for %d shards", shardCount)
+		}
+	}
+}
+
+func TestHeapStaysSmall(t *testing.T) {
+	cache := newCache(t, 256<<20, 1<<20)
+	value := make([]byte, 200)
+	for i := 0; i < 1<<20; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), value)
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > 64<<20 {
+		t.Errorf("Expected the cached 200MB to stay off the heap, heap holds %d bytes", stats.HeapAlloc)
+	}
+}
+
+func BenchmarkCXMmapBytesSet(b *testing.B) {
+	cache := newCache(b, 1024*100, 100000)
+	keys := make([][]byte, 100000)
+	values := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+		values[i] = make([]byte, 1024) // 1 KB values
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i%100000], values[i%100000])
+	}
+}
+
+func BenchmarkCXMmapBytesGetInto(b *testing.B) {
+	cache := newCache(b, 1024*1024*128, 100000)
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+		cache.Set(keys[i], make([]byte, 1024)) // 1 KB values
+	}
+	dst := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst, _ = cache.GetInto(keys[i%100000], dst[:0])
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/cloudxaas/gocache/orderedset
+
+go 1.22.2
@@ -0,0 +1,17 @@
+module github.com/cloudxaas/gocache/s3fifo/bytes
+
+go 1.22.2
+
+require (
+	github.com/cloudxaas/gocache/circularbuffer v0.0.0
+	github.com/cloudxaas/gocache/orderedset v0.0.0
+	github.com/cloudxaas/gocx v0.0.3
+	github.com/zeebo/xxh3 v1.0.2
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+
+replace (
+	github.com/cloudxaas/gocache/circularbuffer => ../../circularbuffer
+	github.com/cloudxaas/gocache/orderedset => ../../orderedset
+)
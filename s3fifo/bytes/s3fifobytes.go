@@ -0,0 +1,325 @@
+package s3fifobytes
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudxaas/gocache/circularbuffer"
+	"github.com/cloudxaas/gocache/orderedset"
+	cx "github.com/cloudxaas/gocx"
+)
+
+const (
+	maxFreq         = 3    // Saturation of the 2-bit access counter
+	initialCapacity = 1024 // Starting ring and ghost capacity, both double when full
+	compactSlack    = 64   // Deleted slots a queue tolerates beyond its live entries
+)
+
+// Cache is a memory bounded cache using the S3-FIFO eviction policy.
+//
+// New entries go into a small FIFO queue holding 10% of the memory. Entries leaving it are
+// moved into the main FIFO queue if they were read while in there, otherwise they are evicted
+// and their key is remembered in a ghost queue. A key found in the ghost queue is inserted
+// straight into the main queue. The main queue evicts like CLOCK, reinserting entries that
+// were read since they were last inserted. One-hit wonders therefore only ever pass through the
+// small queue, and since hits never reorder anything Get only needs the read lock.
+//
+// The queues are circularbuffer rings of keys and the ghost queue is an orderedset. Deleted
+// entries leave their key in a ring until it is reached, the rings are compacted when such
+// slots outnumber the live entries.
+type Cache struct {
+	maxMemory      int64
+	currentMemory  int64
+	smallMax       int64
+	evictBatchSize int
+	entries        map[string]*entry
+	small, main    queue
+	ghost          *orderedset.OrderedSet
+	ghostCapacity  int
+	mu             sync.RWMutex
+}
+
+type entry struct {
+	value   []byte
+	freq    uint32 // Incremented by Get under the read lock, so always accessed atomically
+	inMain  bool
+	deleted bool // The key still occupies a ring slot, the entry holds no memory
+}
+
+// queue is a FIFO ring of keys that grows instead of overwriting its oldest key
+type queue struct {
+	ring     *circularbuffer.CircularBuffer
+	capacity int
+	slots    int // Keys in the ring, deleted ones included
+	live     int
+	memory   int64
+}
+
+func newQueue() queue {
+	return queue{ring: circularbuffer.NewCircularBuffer(initialCapacity), capacity: initialCapacity}
+}
+
+func (q *queue) push(key string) {
+	if q.ring.IsFull() {
+		grown := circularbuffer.NewCircularBuffer(2 * q.capacity)
+		for key, ok := q.ring.Remove(); ok; key, ok = q.ring.Remove() {
+			grown.Add(key)
+		}
+		q.ring = grown
+		q.capacity *= 2
+	}
+	q.ring.Add(key)
+	q.slots++
+}
+
+func (q *queue) pop() (string, bool) {
+	key, ok := q.ring.Remove()
+	if ok {
+		q.slots--
+	}
+	return key, ok
+}
+
+func NewS3FIFOCache(maxMemory int64, evictBatchSize int) *Cache {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	return &Cache{
+		maxMemory:      maxMemory,
+		smallMax:       maxMemory / 10,
+		evictBatchSize: evictBatchSize,
+		entries:        make(map[string]*entry),
+		small:          newQueue(),
+		main:           newQueue(),
+		ghost:          orderedset.NewOrderedSet(initialCapacity),
+		ghostCapacity:  initialCapacity,
+	}
+}
+
+func (c *Cache) estimateMemory(key, value []byte) int64 {
+	return int64(len(key) + len(value) + 10) // Adding constant overhead for index
+}
+
+func (c *Cache) queueOf(e *entry) *queue {
+	if e.inMain {
+		return &c.main
+	}
+	return &c.small
+}
+
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[cx.B2s(key)]
+	if !ok || e.deleted {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	if freq := atomic.LoadUint32(&e.freq); freq < maxFreq {
+		atomic.CompareAndSwapUint32(&e.freq, freq, freq+1) // Losing a race only loses a count
+	}
+	value := e.value
+	c.mu.RUnlock()
+	return value, true
+}
+
+func (c *Cache) Set(key, value []byte) error {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[keyStr]
+	if ok && !e.deleted {
+		// An update counts as a hit and keeps the entry's place in its queue
+		if memSize > c.maxMemory {
+			c.remove(e, key)
+			c.compact(c.queueOf(e))
+			return nil
+		}
+		delta := memSize - c.estimateMemory(key, e.value)
+		c.queueOf(e).memory += delta
+		c.currentMemory += delta
+		e.value = value
+		if freq := atomic.LoadUint32(&e.freq); freq < maxFreq {
+			atomic.StoreUint32(&e.freq, freq+1)
+		}
+
+		// A value that grew may push the cache over its limit. Evict one entry at a time, passing
+		// over the entry just updated, rather than a whole batch that could take it along
+		for c.currentMemory > c.maxMemory && c.evictOne(e) {
+		}
+		return nil
+	}
+
+	if memSize > c.maxMemory {
+		return nil
+	}
+	for c.currentMemory+memSize > c.maxMemory && c.evict() {
+	}
+	if c.currentMemory+memSize > c.maxMemory {
+		return nil
+	}
+
+	// Eviction may have reclaimed the deleted slot, so look the key up again
+	if e, ok = c.entries[keyStr]; ok {
+		// Deleted but still queued, the entry is revived in that slot
+		e.value = value
+		e.deleted = false
+		atomic.StoreUint32(&e.freq, 0)
+	} else {
+		keyStr = string(key) // The rings and the index share this copy of the key
+		e = &entry{value: value, inMain: c.ghost.Contains(keyStr)}
+		c.entries[keyStr] = e
+		c.queueOf(e).push(keyStr)
+	}
+	q := c.queueOf(e)
+	q.live++
+	q.memory += memSize
+	c.currentMemory += memSize
+	if e.inMain {
+		c.growGhost()
+	}
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	c.mu.Lock()
+	if e, ok := c.entries[cx.B2s(key)]; ok && !e.deleted {
+		c.remove(e, key)
+		c.compact(c.queueOf(e))
+	}
+	c.mu.Unlock()
+}
+
+// evict removes up to evictBatchSize entries, it reports false once the cache is empty
+func (c *Cache) evict() bool {
+	for i := 0; i < c.evictBatchSize; i++ {
+		if !c.evictOne(nil) {
+			return i > 0
+		}
+	}
+	return true
+}
+
+// evictOne removes a single entry other than keep, from the small queue while it is over its
+// share of the memory and from the main queue otherwise
+func (c *Cache) evictOne(keep *entry) bool {
+	// Terminates since every pass either removes an entry, moves one out of the small queue,
+	// lowers the access count of one in the main queue or passes over keep once per lap.
+	// Callers keeping an entry make sure it is not the only one left
+	for c.small.live+c.main.live > 0 {
+		if c.small.live > 0 && (c.small.memory >= c.smallMax || c.main.live == 0) {
+			if c.evictSmall(keep) {
+				return true
+			}
+		} else if c.evictMain(keep) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictSmall takes the oldest key of the small queue, moving the entry into the main queue if
+// it was read or is keep and evicting it into the ghost queue otherwise
+func (c *Cache) evictSmall(keep *entry) bool {
+	key, ok := c.small.pop()
+	if !ok {
+		return false
+	}
+	e := c.entries[key]
+	if e.deleted {
+		delete(c.entries, key)
+		return false
+	}
+
+	if atomic.LoadUint32(&e.freq) > 0 || e == keep {
+		memSize := c.estimateMemory(cx.S2b(key), e.value)
+		c.small.live--
+		c.small.memory -= memSize
+		atomic.StoreUint32(&e.freq, 0)
+		e.inMain = true
+		c.main.push(key)
+		c.main.live++
+		c.main.memory += memSize
+		c.growGhost()
+		return false
+	}
+
+	c.remove(e, cx.S2b(key))
+	delete(c.entries, key)
+	c.ghost.Add(key)
+	return true
+}
+
+// evictMain takes the oldest key of the main queue, reinserting the entry with a lower access
+// count if it was read, as it is if it is keep, and evicting it otherwise
+func (c *Cache) evictMain(keep *entry) bool {
+	key, ok := c.main.pop()
+	if !ok {
+		return false
+	}
+	e := c.entries[key]
+	if e.deleted {
+		delete(c.entries, key)
+		return false
+	}
+
+	if e == keep {
+		c.main.push(key)
+		return false
+	}
+	if freq := atomic.LoadUint32(&e.freq); freq > 0 {
+		atomic.StoreUint32(&e.freq, freq-1)
+		c.main.push(key)
+		return false
+	}
+
+	c.remove(e, cx.S2b(key))
+	delete(c.entries, key)
+	return true
+}
+
+// remove releases the entry's memory and marks it deleted, its key stays in the ring until the
+// slot is reached or compacted. Caller must hold the write lock.
+func (c *Cache) remove(e *entry, key []byte) {
+	memSize := c.estimateMemory(key, e.value)
+	q := c.queueOf(e)
+	q.live--
+	q.memory -= memSize
+	c.currentMemory -= memSize
+	e.value = nil
+	e.deleted = true
+}
+
+// compact drops the deleted slots of a queue once they outnumber its live entries
+func (c *Cache) compact(q *queue) {
+	if q.slots-q.live <= q.live+compactSlack {
+		return
+	}
+	for n := q.slots; n > 0; n-- {
+		key, _ := q.pop()
+		if c.entries[key].deleted {
+			delete(c.entries, key)
+			continue
+		}
+		q.push(key)
+	}
+}
+
+// growGhost doubles the ghost queue until it can remember as many keys as the main queue holds
+func (c *Cache) growGhost() {
+	if c.main.live <= c.ghostCapacity {
+		return
+	}
+	capacity := c.ghostCapacity
+	for c.main.live > capacity {
+		capacity *= 2
+	}
+	grown := orderedset.NewOrderedSet(capacity)
+	for key, ok := c.ghost.Remove(); ok; key, ok = c.ghost.Remove() {
+		grown.Add(key)
+	}
+	c.ghost = grown
+	c.ghostCapacity = capacity
+}
@@ -0,0 +1,266 @@
+package s3fifobytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// queueKeys drains a queue's ring and refills it in the same order, returning the keys oldest first
+func queueKeys(q *queue) []string {
+	keys := make([]string, 0, q.slots)
+	for key, ok := q.ring.Remove(); ok; key, ok = q.ring.Remove() {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		q.ring.Add(key)
+	}
+	return keys
+}
+
+// checkInvariants verifies the rings, index and memory accounting agree with each other
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var total int64
+	for _, q := range []*queue{&c.small, &c.main} {
+		keys := queueKeys(q)
+		if len(keys) != q.slots {
+			t.Fatalf("Ring holds %d keys, queue counts %d slots", len(keys), q.slots)
+		}
+		live := 0
+		var memory int64
+		for _, key := range keys {
+			e, ok := c.entries[key]
+			if !ok {
+				t.Fatalf("Ring slot %q has no entry", key)
+			}
+			if seen[key] {
+				t.Fatalf("Key %q is queued twice", key)
+			}
+			seen[key] = true
+			if e.inMain != (q == &c.main) {
+				t.Fatalf("Entry %q is in the wrong queue", key)
+			}
+			if !e.deleted {
+				live++
+				memory += c.estimateMemory([]byte(key), e.value)
+			}
+		}
+		if live != q.live || memory != q.memory {
+			t.Fatalf("Queue has %d live entries holding %d bytes, counted %d and %d", live, memory, q.live, q.memory)
+		}
+		total += memory
+	}
+	if len(seen) != len(c.entries) {
+		t.Fatalf("%d queued keys, %d entries", len(seen), len(c.entries))
+	}
+	if total != c.currentMemory || total > c.maxMemory {
+		t.Fatalf("Entries hold %d bytes, currentMemory %d, maxMemory %d", total, c.currentMemory, c.maxMemory)
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	cache := NewS3FIFOCache(1024, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("a"))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	cache.Set([]byte("a"), []byte("again"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "again" {
+		t.Errorf("Expected a deleted key to be settable again, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("huge"), make([]byte, 2048))
+	if _, ok := cache.Get([]byte("huge")); ok {
+		t.Errorf("Expected an entry larger than the cache to be rejected")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestOneHitWondersStayInSmallQueue(t *testing.T) {
+	entrySize := int64(len("hot00") + 8 + 10)
+	cache := NewS3FIFOCache(100*entrySize, 1)
+	value := make([]byte, 8)
+
+	// Read while in the small queue, so they are promoted on their way out
+	for i := 0; i < 80; i++ {
+		key := []byte(fmt.Sprintf("hot%02d", i))
+		cache.Set(key, value)
+		cache.Get(key)
+	}
+	for i := 0; i < 10000; i++ {
+		cache.Set([]byte(fmt.Sprintf("s%04d", i)), value)
+	}
+
+	for i := 0; i < 80; i++ {
+		if _, ok := cache.Get([]byte(fmt.Sprintf("hot%02d", i))); !ok {
+			t.Fatalf("Expected hot%02d to survive a scan of one-hit wonders", i)
+		}
+	}
+	if cache.main.live != 80 {
+		t.Errorf("Expected only the hot keys in the main queue, it holds %d entries", cache.main.live)
+	}
+	checkInvariants(t, cache)
+}
+
+func TestGhostHitGoesToMain(t *testing.T) {
+	entrySize := int64(len("key00") + 8 + 10)
+	cache := NewS3FIFOCache(20*entrySize, 1)
+	value := make([]byte, 8)
+
+	for i := 0; i < 30; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%02d", i)), value)
+	}
+	if _, ok := cache.Get([]byte("key00")); ok {
+		t.Fatalf("Expected key00 to be evicted from the small queue")
+	}
+	if !cache.ghost.Contains("key00") {
+		t.Fatalf("Expected key00 to be remembered in the ghost queue")
+	}
+
+	cache.Set([]byte("key00"), value)
+	if e := cache.entries["key00"]; e == nil || !e.inMain {
+		t.Errorf("Expected a ghost hit to be inserted into the main queue")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestDeletedSlotsAreCompacted(t *testing.T) {
+	cache := NewS3FIFOCache(1<<20, 1)
+	for i := 0; i < 100000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		cache.Set(key, []byte("value"))
+		cache.Del(key)
+	}
+	if cache.small.slots > compactSlack+1 || len(cache.entries) > compactSlack+1 {
+		t.Errorf("Expected deleted slots to be reclaimed, %d slots and %d entries left", cache.small.slots, len(cache.entries))
+	}
+	checkInvariants(t, cache)
+}
+
+func TestOverwriteBatchEviction(t *testing.T) {
+	cache := NewS3FIFOCache(100, 4)
+	cache.Set([]byte("a"), make([]byte, 29))
+	cache.Set([]byte("b"), make([]byte, 29))
+
+	// Growing a to 80 bytes needs b gone, a batch of 4 must not take a along
+	cache.Set([]byte("a"), make([]byte, 69))
+	if value, ok := cache.Get([]byte("a")); !ok || len(value) != 69 {
+		t.Errorf("Expected a to hold the larger value, got %d bytes, %v", len(value), ok)
+	}
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be evicted to make room for the larger a")
+	}
+	checkInvariants(t, cache)
+
+	// Every other entry read, so the eviction passes over them in the main queue, not a
+	cache = NewS3FIFOCache(1000, 4)
+	for i := 0; i < 300; i++ {
+		key := []byte(fmt.Sprintf("key%d", i%20))
+		cache.Set(key, make([]byte, 20))
+		cache.Get(key)
+		cache.Set(key, make([]byte, 20+i%60))
+		if value, ok := cache.Get(key); !ok || len(value) != 20+i%60 {
+			t.Fatalf("Expected %s to hold the larger value, got %d bytes, %v", key, len(value), ok)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestRandomOperations(t *testing.T) {
+	cache := NewS3FIFOCache(4096, 4)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(500)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSharded(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := cache.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	cache.Del([]byte("key1"))
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func BenchmarkCXS3FIFOBytesSet(b *testing.B) {
+	cache := NewS3FIFOCache(1024*100, 1)
+	keys := make([][]byte, 100000)
+	values := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+		values[i] = make([]byte, 1024) // 1 KB values
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i%100000], values[i%100000])
+	}
+}
+
+func BenchmarkCXS3FIFOBytesGetParallel(b *testing.B) {
+	cache := NewS3FIFOCache(1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			_, _ = cache.Get(keys[i%100000])
+		}
+	})
+}
+
+func BenchmarkCXS3FIFOBytesShardedGetParallel(b *testing.B) {
+	cache := NewShardedCache(16, 1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			_, _ = cache.Get(keys[i%100000])
+		}
+	})
+}
@@ -0,0 +1,10 @@
+module github.com/cloudxaas/gocache/sieve/bytes
+
+go 1.22.2
+
+require (
+	github.com/cloudxaas/gocx v0.0.3
+	github.com/zeebo/xxh3 v1.0.2
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
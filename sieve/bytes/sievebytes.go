@@ -0,0 +1,198 @@
+package sievebytes
+
+import (
+	"sync"
+	"sync/atomic"
+
+	cx "github.com/cloudxaas/gocx"
+)
+
+// Cache is a memory bounded cache using the SIEVE eviction policy.
+//
+// Entries sit in a FIFO queue and are never moved on a hit, a Get only sets the entry's
+// visited bit. On eviction a hand sweeps from the oldest towards the newest entry, clearing
+// visited bits, and evicts the first entry that was not visited since the hand last passed.
+// Since hits do not reorder anything, Get only needs the read lock.
+type Cache struct {
+	maxMemory      int64
+	currentMemory  int64
+	evictBatchSize int
+	entries        []entry
+	freeEntries    []int // Stack of indices of free entries
+	indexMap       map[string]int
+	head, tail     int // Newest and oldest entries
+	hand           int // Next eviction candidate, -1 to start from the tail
+	mu             sync.RWMutex
+}
+
+type entry struct {
+	key, value []byte
+	visited    uint32 // Set by Get under the read lock, so always accessed atomically
+	prev, next int    // prev is towards the tail
+}
+
+func NewSieveCache(maxMemory int64, evictBatchSize int) *Cache {
+	if evictBatchSize < 1 {
+		evictBatchSize = 1
+	}
+	return &Cache{
+		maxMemory:      maxMemory,
+		evictBatchSize: evictBatchSize,
+		entries:        make([]entry, 0),
+		freeEntries:    make([]int, 0),
+		indexMap:       make(map[string]int),
+		head:           -1,
+		tail:           -1,
+		hand:           -1,
+	}
+}
+
+func (c *Cache) estimateMemory(key, value []byte) int64 {
+	return int64(len(key) + len(value) + 10) // Adding constant overhead for index
+}
+
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	c.mu.RLock()
+	idx, ok := c.indexMap[cx.B2s(key)]
+	if !ok {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	e := &c.entries[idx]
+	if atomic.LoadUint32(&e.visited) == 0 {
+		atomic.StoreUint32(&e.visited, 1)
+	}
+	value := e.value
+	c.mu.RUnlock()
+	return value, true
+}
+
+func (c *Cache) Set(key, value []byte) error {
+	keyStr := cx.B2s(key)
+	memSize := c.estimateMemory(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idx, ok := c.indexMap[keyStr]; ok {
+		// An update counts as a hit and keeps the entry's place in the queue
+		if memSize > c.maxMemory {
+			c.remove(idx)
+			return nil
+		}
+		e := &c.entries[idx]
+		c.currentMemory += memSize - c.estimateMemory(e.key, e.value)
+		// Re-insert so the map key refers to the newly stored key slice
+		delete(c.indexMap, keyStr)
+		e.key = key
+		e.value = value
+		c.indexMap[keyStr] = idx
+		atomic.StoreUint32(&e.visited, 1)
+
+		// A value that grew may push the cache over its limit. Evict one entry at a time and stop
+		// before the entry just updated rather than a whole batch that could take it along
+		for c.currentMemory > c.maxMemory {
+			victim := c.victim()
+			if victim == idx {
+				break
+			}
+			c.remove(victim)
+		}
+		return nil
+	}
+
+	if memSize > c.maxMemory {
+		return nil
+	}
+	for c.currentMemory+memSize > c.maxMemory && c.evict() {
+	}
+	if c.currentMemory+memSize > c.maxMemory {
+		return nil
+	}
+
+	var idx int
+	if len(c.freeEntries) > 0 {
+		idx = c.freeEntries[len(c.freeEntries)-1]
+		c.freeEntries = c.freeEntries[:len(c.freeEntries)-1]
+		c.entries[idx] = entry{key: key, value: value, prev: -1, next: -1}
+	} else {
+		c.entries = append(c.entries, entry{key: key, value: value, prev: -1, next: -1})
+		idx = len(c.entries) - 1
+	}
+
+	// New entries go in at the head, the hand works its way up from the tail
+	c.entries[idx].prev = c.head
+	if c.head != -1 {
+		c.entries[c.head].next = idx
+	}
+	c.head = idx
+	if c.tail == -1 {
+		c.tail = idx
+	}
+
+	c.indexMap[keyStr] = idx
+	c.currentMemory += memSize
+	return nil
+}
+
+func (c *Cache) Del(key []byte) {
+	c.mu.Lock()
+	if idx, ok := c.indexMap[cx.B2s(key)]; ok {
+		c.remove(idx)
+	}
+	c.mu.Unlock()
+}
+
+// evict removes up to evictBatchSize unvisited entries, it reports false once the cache is empty
+func (c *Cache) evict() bool {
+	for i := 0; i < c.evictBatchSize; i++ {
+		if c.tail == -1 {
+			return i > 0
+		}
+		c.remove(c.victim())
+	}
+	return true
+}
+
+// victim moves the hand to the next unvisited entry and returns it, clearing the visited bits it
+// passes. Caller must hold the write lock and make sure the queue is not empty
+func (c *Cache) victim() int {
+	idx := c.hand
+	if idx == -1 {
+		idx = c.tail
+	}
+	// Terminates within one lap since every visited entry passed gets its bit cleared
+	for atomic.LoadUint32(&c.entries[idx].visited) != 0 {
+		atomic.StoreUint32(&c.entries[idx].visited, 0)
+		idx = c.entries[idx].next
+		if idx == -1 {
+			idx = c.tail
+		}
+	}
+	c.hand = idx // remove moves the hand on to the next newer entry
+	return idx
+}
+
+// remove unlinks the entry at idx and frees its slot, caller must hold the write lock
+func (c *Cache) remove(idx int) {
+	e := &c.entries[idx]
+	if c.hand == idx {
+		c.hand = e.next
+	}
+
+	if e.prev != -1 {
+		c.entries[e.prev].next = e.next
+	} else {
+		c.tail = e.next
+	}
+	if e.next != -1 {
+		c.entries[e.next].prev = e.prev
+	} else {
+		c.head = e.prev
+	}
+
+	c.currentMemory -= c.estimateMemory(e.key, e.value)
+	delete(c.indexMap, cx.B2s(e.key))
+	c.entries[idx] = entry{prev: -1, next: -1} // Drop the references so the GC can reclaim them
+	c.freeEntries = append(c.freeEntries, idx)
+}
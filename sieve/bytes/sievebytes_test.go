@@ -0,0 +1,201 @@
+package sievebytes
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// checkInvariants verifies the queue, index, free slots and memory accounting agree
+func checkInvariants(t *testing.T, c *Cache) {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var memory int64
+	linked := 0
+	prev := -1
+	for idx := c.tail; idx != -1; idx = c.entries[idx].next {
+		e := c.entries[idx]
+		if e.prev != prev {
+			t.Fatalf("Entry %d prev is %d, expected %d", idx, e.prev, prev)
+		}
+		if c.indexMap[string(e.key)] != idx {
+			t.Fatalf("Index of %q does not point at entry %d", e.key, idx)
+		}
+		memory += c.estimateMemory(e.key, e.value)
+		prev = idx
+		linked++
+	}
+	if c.head != prev {
+		t.Fatalf("Head is %d, expected %d", c.head, prev)
+	}
+	if linked != len(c.indexMap) || linked+len(c.freeEntries) != len(c.entries) {
+		t.Fatalf("%d linked, %d indexed, %d free of %d slots", linked, len(c.indexMap), len(c.freeEntries), len(c.entries))
+	}
+	if memory != c.currentMemory || memory > c.maxMemory {
+		t.Fatalf("Entries hold %d bytes, currentMemory %d, maxMemory %d", memory, c.currentMemory, c.maxMemory)
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	cache := NewSieveCache(1024, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "1" {
+		t.Errorf("Expected a -> 1, got %q, %v", value, ok)
+	}
+	cache.Set([]byte("a"), []byte("updated"))
+	if value, ok := cache.Get([]byte("a")); !ok || string(value) != "updated" {
+		t.Errorf("Expected a -> updated, got %q, %v", value, ok)
+	}
+	cache.Del([]byte("a"))
+	if _, ok := cache.Get([]byte("a")); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	cache.Set([]byte("huge"), make([]byte, 2048))
+	if _, ok := cache.Get([]byte("huge")); ok {
+		t.Errorf("Expected an entry larger than the cache to be rejected")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestVisitedEntriesSurvive(t *testing.T) {
+	entrySize := int64(1 + 1 + 10)
+	cache := NewSieveCache(3*entrySize, 1)
+	cache.Set([]byte("a"), []byte("1"))
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Set([]byte("c"), []byte("3"))
+	cache.Get([]byte("a"))
+
+	// a is the oldest but was visited, so b goes first, then c
+	cache.Set([]byte("d"), []byte("4"))
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	cache.Set([]byte("e"), []byte("5"))
+	if _, ok := cache.Get([]byte("c")); ok {
+		t.Errorf("Expected c to be evicted")
+	}
+	if _, ok := cache.Get([]byte("a")); !ok {
+		t.Errorf("Expected visited a to survive")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestOverwriteBatchEviction(t *testing.T) {
+	cache := NewSieveCache(100, 4)
+	cache.Set([]byte("a"), make([]byte, 29))
+	cache.Set([]byte("b"), make([]byte, 29))
+
+	// Growing a to 80 bytes needs b gone, a batch of 4 must not take a along
+	cache.Set([]byte("a"), make([]byte, 69))
+	if value, ok := cache.Get([]byte("a")); !ok || len(value) != 69 {
+		t.Errorf("Expected a to hold the larger value, got %d bytes, %v", len(value), ok)
+	}
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Errorf("Expected b to be evicted to make room for the larger a")
+	}
+	checkInvariants(t, cache)
+}
+
+func TestRandomOperations(t *testing.T) {
+	cache := NewSieveCache(4096, 4)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		key := []byte(fmt.Sprintf("key%d", rng.Intn(500)))
+		switch rng.Intn(4) {
+		case 0:
+			cache.Del(key)
+		case 1:
+			cache.Set(key, make([]byte, rng.Intn(64)))
+		default:
+			cache.Get(key)
+		}
+	}
+	checkInvariants(t, cache)
+}
+
+func TestSharded(t *testing.T) {
+	cache := NewShardedCache(4, 64*1024, 1)
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := cache.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected key%d -> value%d, got %q, %v", i, i, value, ok)
+		}
+	}
+	cache.Del([]byte("key1"))
+	if _, ok := cache.Get([]byte("key1")); ok {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	for _, shard := range cache.shards {
+		checkInvariants(t, shard)
+	}
+}
+
+func BenchmarkCXSieveBytesSet(b *testing.B) {
+	cache := NewSieveCache(1024*100, 1)
+	keys := make([][]byte, 100000)
+	values := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+		values[i] = make([]byte, 1024) // 1 KB values
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(keys[i%100000], values[i%100000])
+	}
+}
+
+func BenchmarkCXSieveBytesGet(b *testing.B) {
+	cache := NewSieveCache(1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.Get(keys[i%100000])
+	}
+}
+
+func BenchmarkCXSieveBytesGetParallel(b *testing.B) {
+	cache := NewSieveCache(1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			_, _ = cache.Get(keys[i%100000])
+		}
+	})
+}
+
+func BenchmarkCXSieveBytesShardedGetParallel(b *testing.B) {
+	cache := NewShardedCache(16, 1024*100, 1)
+	for i := 0; i < 100000; i++ {
+		cache.Set([]byte{byte(i)}, make([]byte, 1024)) // 1 KB values
+	}
+	keys := make([][]byte, 100000)
+	for i := 0; i < 100000; i++ {
+		keys[i] = []byte{byte(i)}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			_, _ = cache.Get(keys[i%100000])
+		}
+	})
+}